@@ -0,0 +1,257 @@
+// Copyright 2018 <kassCrypto@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this
+// software and associated documentation files (the "Software"), to deal in the Software
+// without restriction, including without limitation the rights to use, copy, modify,
+// merge, publish, distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to the following
+// conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies
+// or substantial portions of the Software.
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+// INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A
+// PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT
+// HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF
+// CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+// OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// Package bytecode converts a parser.Program to and from the
+// compiled *.scb format.
+//
+// The format is deterministic, encoding the same program always
+// produces the same bytes, so a script may be identified by the
+// hash of its bytecode. All integers are big-endian and varints are
+// unsigned LEB128 as written by encoding/binary, in their shortest
+// form.
+//
+//	magic    "SPLC"
+//	version  1 byte, currently 1
+//	count    varint, number of tokens
+//	tokens   count tokens, each an opcode byte and its operand
+//
+// The opcode is the token type, as listed in the README. Literal
+// opcodes are followed by a typed operand, IF, IFTRUE, ELSE and FUNC
+// by their jump target, all other opcodes have no operand.
+//
+//	INT      8 bytes, two's complement
+//	FLOAT    8 bytes, IEEE 754
+//	STRING   varint length, followed by the utf-8 bytes
+//	BYTES    varint length, followed by the bytes
+//	BOOLEAN  1 byte, 0 or 1
+//	jumps    varint, index of the target token
+//
+// Markers are not stored, they are rebuilt from the MARK and FUNC
+// tokens when decoding. Source positions are not stored either.
+package bytecode
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"splashcode/lexer"
+	"splashcode/parser"
+)
+
+// Magic starts every compiled program.
+const Magic = "SPLC"
+
+// Version of the format written by Encode.
+const Version = 1
+
+// Encode will convert the program to bytecode. An error is
+// returned if a token has a value that cannot be encoded.
+func Encode(prog *parser.Program) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(Magic)
+	buf.WriteByte(Version)
+	writeUvarint(&buf, uint64(len(prog.Tokens)))
+
+	for i, token := range prog.Tokens {
+		if !lexer.IsTokenType(token.TokenType) || token.TokenType > math.MaxUint8 {
+			return nil, fmt.Errorf("token %d: unknown token type %d", i, token.TokenType)
+		}
+		buf.WriteByte(byte(token.TokenType))
+
+		ok := true
+		switch token.TokenType {
+		case lexer.TypeINT:
+			var v int64
+			v, ok = token.Value.(int64)
+			binary.Write(&buf, binary.BigEndian, v)
+		case lexer.TypeFLOAT:
+			var v float64
+			v, ok = token.Value.(float64)
+			binary.Write(&buf, binary.BigEndian, math.Float64bits(v))
+		case lexer.TypeSTRING:
+			var v string
+			v, ok = token.Value.(string)
+			writeUvarint(&buf, uint64(len(v)))
+			buf.WriteString(v)
+		case lexer.TypeBYTES:
+			var v []byte
+			v, ok = token.Value.([]byte)
+			writeUvarint(&buf, uint64(len(v)))
+			buf.Write(v)
+		case lexer.TypeBOOLEAN:
+			var v bool
+			v, ok = token.Value.(bool)
+			if v {
+				buf.WriteByte(1)
+			} else {
+				buf.WriteByte(0)
+			}
+		case lexer.TypeIF, lexer.TypeIFTRUE, lexer.TypeELSE, lexer.TypeFUNC:
+			var v int
+			v, ok = token.Value.(int)
+			ok = ok && v >= 0
+			writeUvarint(&buf, uint64(v))
+		}
+		if !ok {
+			return nil, fmt.Errorf("token %d: cannot encode %v", i, token)
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Decode will convert bytecode written by Encode back to a program.
+// Decode only checks the encoding, use parser.Verify before running
+// a decoded program.
+func Decode(data []byte) (prog parser.Program, err error) {
+	prog, _, err = decode(data)
+	return
+}
+
+// decode is Decode, it also returns the offset of every token.
+func decode(data []byte) (prog parser.Program, offsets []int, err error) {
+	r := &reader{data: data}
+
+	if len(data) < len(Magic)+1 || string(data[:len(Magic)]) != Magic {
+		return prog, nil, errors.New("bytecode: not a compiled splashcode program")
+	}
+	if data[len(Magic)] != Version {
+		return prog, nil, fmt.Errorf("bytecode: unsupported version %d", data[len(Magic)])
+	}
+	r.offset = len(Magic) + 1
+
+	count := r.uvarint()
+	// Every token is at least one byte
+	if r.err == nil && count > uint64(len(data)-r.offset) {
+		r.fail("token count %d exceeds data", count)
+	}
+
+	prog.Markers = make(map[string]int)
+	prog.Tokens = make([]lexer.Token, 0, int(count))
+
+	for i := 0; r.err == nil && i < int(count); i++ {
+		offsets = append(offsets, r.offset)
+		token := lexer.Token{TokenType: int(r.byte())}
+		if r.err == nil && !lexer.IsTokenType(token.TokenType) {
+			r.fail("unknown opcode %d", token.TokenType)
+		}
+
+		switch token.TokenType {
+		case lexer.TypeINT:
+			token.Value = int64(binary.BigEndian.Uint64(r.bytes(8)))
+		case lexer.TypeFLOAT:
+			token.Value = math.Float64frombits(binary.BigEndian.Uint64(r.bytes(8)))
+		case lexer.TypeSTRING:
+			token.Value = string(r.bytes(r.uvarint()))
+		case lexer.TypeBYTES:
+			token.Value = append([]byte{}, r.bytes(r.uvarint())...)
+		case lexer.TypeBOOLEAN:
+			b := r.byte()
+			if b > 1 {
+				r.fail("invalid BOOLEAN %d", b)
+			}
+			token.Value = b == 1
+		case lexer.TypeIF, lexer.TypeIFTRUE, lexer.TypeELSE, lexer.TypeFUNC:
+			target := r.uvarint()
+			if target > math.MaxInt32 {
+				r.fail("jump target %d out of range", target)
+			}
+			token.Value = int(target)
+		}
+		prog.Tokens = append(prog.Tokens, token)
+	}
+
+	if r.err == nil && r.offset != len(data) {
+		r.fail("%d unexpected trailing bytes", len(data)-r.offset)
+	}
+	if r.err != nil {
+		return prog, offsets, r.err
+	}
+
+	// Rebuild markers
+	for i, token := range prog.Tokens {
+		if token.TokenType != lexer.TypeMARK && token.TokenType != lexer.TypeFUNC {
+			continue
+		}
+		if i+1 < len(prog.Tokens) && prog.Tokens[i+1].TokenType == lexer.TypeSTRING {
+			prog.Markers[prog.Tokens[i+1].Value.(string)] = i + 1
+		}
+	}
+
+	return prog, offsets, nil
+}
+
+func writeUvarint(buf *bytes.Buffer, v uint64) {
+	tmp := make([]byte, binary.MaxVarintLen64)
+	buf.Write(tmp[:binary.PutUvarint(tmp, v)])
+}
+
+// reader reads bytecode, after the first error every read returns
+// zero values and err holds the error.
+type reader struct {
+	data   []byte
+	offset int
+	err    error
+}
+
+func (r *reader) fail(format string, args ...interface{}) {
+	if r.err == nil {
+		r.err = fmt.Errorf("bytecode: offset %d: %s", r.offset, fmt.Sprintf(format, args...))
+	}
+}
+
+func (r *reader) byte() byte {
+	if b := r.bytes(1); len(b) == 1 {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *reader) bytes(n uint64) []byte {
+	if r.err != nil {
+		return make([]byte, 8)
+	}
+	if n > uint64(len(r.data)-r.offset) {
+		r.fail("unexpected end of data")
+		return make([]byte, 8)
+	}
+	b := r.data[r.offset : r.offset+int(n)]
+	r.offset += int(n)
+	return b
+}
+
+func (r *reader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.data[r.offset:])
+	if n <= 0 {
+		r.fail("invalid varint")
+		return 0
+	}
+	// Only the shortest form is canonical
+	tmp := make([]byte, binary.MaxVarintLen64)
+	if binary.PutUvarint(tmp, v) != n {
+		r.fail("non-canonical varint")
+		return 0
+	}
+	r.offset += n
+	return v
+}
@@ -0,0 +1,123 @@
+// Copyright 2018 <kassCrypto@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this
+// software and associated documentation files (the "Software"), to deal in the Software
+// without restriction, including without limitation the rights to use, copy, modify,
+// merge, publish, distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to the following
+// conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies
+// or substantial portions of the Software.
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+// INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A
+// PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT
+// HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF
+// CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+// OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package bytecode
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"splashcode/lexer"
+	"splashcode/parser"
+	"testing"
+)
+
+// roundTrip encodes prog, decodes it and encodes it again, the two
+// encodings must be the same bytes.
+func roundTrip(t *testing.T, name string, prog parser.Program) {
+	data, err := Encode(&prog)
+	if err != nil {
+		t.Fatalf("%s: Encode: %v", name, err)
+	}
+	decoded, err := Decode(data)
+	if err != nil {
+		t.Fatalf("%s: Decode: %v", name, err)
+	}
+	again, err := Encode(&decoded)
+	if err != nil {
+		t.Fatalf("%s: Encode decoded: %v", name, err)
+	}
+	if !bytes.Equal(data, again) {
+		t.Errorf("%s: encoding is not deterministic\n first  %x\n second %x", name, data, again)
+	}
+	if len(decoded.Tokens) != len(prog.Tokens) {
+		t.Fatalf("%s: decoded %d tokens, want %d", name, len(decoded.Tokens), len(prog.Tokens))
+	}
+	for i, token := range prog.Tokens {
+		if decoded.Tokens[i].String() != token.String() {
+			t.Errorf("%s: token %d decoded as %v, want %v", name, i, decoded.Tokens[i], token)
+		}
+	}
+}
+
+func TestRoundTripLiterals(t *testing.T) {
+	tokens := []lexer.Token{
+		{TokenType: lexer.TypeINT, Value: int64(0)},
+		{TokenType: lexer.TypeINT, Value: int64(math.MinInt64)},
+		{TokenType: lexer.TypeFLOAT, Value: 2.5},
+		{TokenType: lexer.TypeFLOAT, Value: math.Inf(-1)},
+		{TokenType: lexer.TypeSTRING, Value: ""},
+		{TokenType: lexer.TypeSTRING, Value: "one, two\n"},
+		{TokenType: lexer.TypeBOOLEAN, Value: true},
+		{TokenType: lexer.TypeBOOLEAN, Value: false},
+		{TokenType: lexer.TypeBYTES, Value: []byte{}},
+		{TokenType: lexer.TypeBYTES, Value: bytes.Repeat([]byte{0xff}, 300)},
+		{TokenType: lexer.TypeSTRING, Value: string(bytes.Repeat([]byte{'x'}, 300))},
+		{TokenType: lexer.TypeIFTRUE},
+		{TokenType: lexer.TypeDROP},
+		{TokenType: lexer.TypeELSE},
+		{TokenType: lexer.TypeDUP},
+		{TokenType: lexer.TypeENDIF},
+	}
+	prog, err := parser.Parse(tokens)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roundTrip(t, "literals", prog)
+}
+
+func TestRoundTripExamples(t *testing.T) {
+	files, err := filepath.Glob("../lib/*.sc")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no examples found: %v", err)
+	}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens, err := lexer.TokenizeFile(file, string(data), false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		prog, err := parser.Parse(tokens)
+		if err != nil {
+			t.Fatal(err)
+		}
+		roundTrip(t, file, prog)
+	}
+}
+
+func TestDecodeEncodeCompiled(t *testing.T) {
+	data, err := ioutil.ReadFile("../lib/compiled.scb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	prog, err := Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := Encode(&prog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, again) {
+		t.Errorf("re-encoding lib/compiled.scb changed it\n file   %x\n encode %x", data, again)
+	}
+}
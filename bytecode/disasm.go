@@ -0,0 +1,84 @@
+// Copyright 2018 <kassCrypto@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this
+// software and associated documentation files (the "Software"), to deal in the Software
+// without restriction, including without limitation the rights to use, copy, modify,
+// merge, publish, distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to the following
+// conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies
+// or substantial portions of the Software.
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+// INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A
+// PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT
+// HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF
+// CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+// OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package bytecode
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"splashcode/lexer"
+	"strings"
+)
+
+// Disassemble will decode the bytecode and write a listing of it to
+// w, one token per line with its byte offset, index, opcode and
+// operand. Jump targets and labels are resolved to the token they
+// move the execution cursor to, and every marker is printed as
+// "name:" before the token it points at.
+func Disassemble(w io.Writer, data []byte) error {
+	prog, offsets, err := decode(data)
+	if err != nil {
+		return err
+	}
+
+	// Marker names by the index they point at
+	names := make(map[int][]string)
+	for name, index := range prog.Markers {
+		names[index] = append(names[index], name)
+	}
+
+	// target formats a token index and its byte offset
+	target := func(index int) string {
+		if index < 0 || index >= len(offsets) {
+			return fmt.Sprintf("%04d (out of range)", index)
+		}
+		return fmt.Sprintf("%04d (0x%04x)", index, offsets[index])
+	}
+
+	fmt.Fprintf(w, "; version %d, %d tokens, %d bytes\n", data[len(Magic)], len(prog.Tokens), len(data))
+	for i, token := range prog.Tokens {
+		sort.Strings(names[i])
+		for _, name := range names[i] {
+			fmt.Fprintf(w, "%s:\n", name)
+		}
+
+		operand := ""
+		switch token.TokenType {
+		case lexer.TypeSTRING:
+			operand = fmt.Sprintf("%q", token.Value)
+		case lexer.TypeINT, lexer.TypeFLOAT, lexer.TypeBOOLEAN, lexer.TypeBYTES:
+			operand = token.ValueString()
+		case lexer.TypeIF, lexer.TypeIFTRUE, lexer.TypeELSE, lexer.TypeFUNC:
+			operand = "-> " + target(token.Value.(int))
+		case lexer.TypeGOTO, lexer.TypeCALL:
+			if i+1 < len(prog.Tokens) {
+				label, _ := prog.Tokens[i+1].Value.(string)
+				if index, ok := prog.Markers[label]; ok {
+					operand = fmt.Sprintf("-> %s %s", label, target(index))
+				} else {
+					operand = fmt.Sprintf("-> %q (unknown label)", label)
+				}
+			}
+		}
+
+		line := fmt.Sprintf("  0x%04x  %04d  %-8s %s", offsets[i], i, lexer.TokenTypeToString(token.TokenType), operand)
+		fmt.Fprintln(w, strings.TrimRight(line, " "))
+	}
+	return nil
+}
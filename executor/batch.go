@@ -0,0 +1,163 @@
+// Copyright 2018 <kassCrypto@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this
+// software and associated documentation files (the "Software"), to deal in the Software
+// without restriction, including without limitation the rights to use, copy, modify,
+// merge, publish, distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to the following
+// conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies
+// or substantial portions of the Software.
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+// INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A
+// PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT
+// HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF
+// CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+// OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package executor
+
+import (
+	"runtime"
+	"splashcode/lexer"
+	"splashcode/parser"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Job is one script of a batch, such as the script of a transaction
+// in a block.
+type Job struct {
+	// Script is run if set, otherwise Program is compiled first.
+	// Compiling once and sharing the Script is cheaper when many
+	// jobs run the same program.
+	Script  *Script
+	Program *parser.Program
+
+	Input   lexer.Token
+	Context TxContext // Replaces Config.Context for this job
+}
+
+// BatchConfig holds the settings of RunBatch.
+type BatchConfig struct {
+	Config // Settings of every run, Context is taken from the Job
+
+	// Workers is the most jobs run at once, 0 uses one per CPU.
+	Workers int
+
+	// StopOnFailure skips the jobs not yet started once any job
+	// has failed.
+	StopOnFailure bool
+}
+
+// BatchResult is the outcome of one job, Err is nil if it passed. A
+// job passes if it runs without error and leaves a truthy element on
+// top of the stack, otherwise it fails.
+type BatchResult struct {
+	Result
+	Err     error
+	Skipped bool // The job was not run because of StopOnFailure
+}
+
+// BatchStats sums up a batch.
+type BatchStats struct {
+	Passed   int
+	Failed   int // Jobs that returned an error or left a falsy top of stack
+	Skipped  int
+	GasUsed  uint64 // Gas used by all jobs that were run
+	Duration time.Duration
+
+	// FirstFailure is the index of the first failed job in the
+	// batch, or -1 if every job that was run passed.
+	FirstFailure int
+}
+
+// RunBatch will run every job on a pool of config.Workers goroutines
+// and return their results in the order of jobs. Jobs are started in
+// order, so with StopOnFailure only jobs after a failed job can be
+// skipped.
+func RunBatch(jobs []Job, config BatchConfig) ([]BatchResult, BatchStats) {
+	start := time.Now()
+	results := make([]BatchResult, len(jobs))
+
+	workers := config.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	if workers > len(jobs) {
+		workers = len(jobs)
+	}
+
+	var next atomic.Int64
+	var failed atomic.Bool
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(next.Add(1) - 1)
+				if i >= len(jobs) {
+					return
+				}
+				if config.StopOnFailure && failed.Load() {
+					results[i].Skipped = true
+					continue
+				}
+				results[i] = runJob(jobs[i], config.Config)
+				if results[i].Err != nil {
+					failed.Store(true)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	stats := BatchStats{FirstFailure: -1}
+	for i, result := range results {
+		switch {
+		case result.Skipped:
+			stats.Skipped++
+			break
+		case result.Err != nil:
+			stats.Failed++
+			if stats.FirstFailure < 0 {
+				stats.FirstFailure = i
+			}
+			break
+		default:
+			stats.Passed++
+			break
+		}
+		stats.GasUsed += result.GasUsed
+	}
+	stats.Duration = time.Since(start)
+	return results, stats
+}
+
+// runJob runs the job with its context, like RunPair the job only
+// passes if it leaves a truthy element on top of the stack.
+func runJob(job Job, config Config) (result BatchResult) {
+	config.Context = job.Context
+	script := job.Script
+	if script == nil {
+		if job.Program == nil {
+			result.Err = newError(ErrInvalidProgram, "job has no script")
+			return
+		}
+		if script, result.Err = compileWithPolicy(job.Program, config.Policy); result.Err != nil {
+			result.Stack = make(parser.Stack, 0)
+			return
+		}
+	}
+
+	vm := newMachine(script, config.Stack)
+	err := vm.run(job.Input, config)
+	if err == nil {
+		err = vm.checkTop("script")
+	}
+	result.Result, result.Err = vm.result(err), err
+	return
+}
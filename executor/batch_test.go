@@ -0,0 +1,96 @@
+// Copyright 2018 <kassCrypto@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this
+// software and associated documentation files (the "Software"), to deal in the Software
+// without restriction, including without limitation the rights to use, copy, modify,
+// merge, publish, distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to the following
+// conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies
+// or substantial portions of the Software.
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+// INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A
+// PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT
+// HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF
+// CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+// OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package executor
+
+import (
+	"splashcode/lexer"
+	"splashcode/parser"
+	"testing"
+)
+
+// batchJobs returns n jobs sharing one Script that loops up to its
+// input, every 7th job has the wrong amount and fails its VERIFY.
+func batchJobs(t *testing.T, n int) []Job {
+	tokens, err := lexer.Tokenize(`0xff, DROP, AMOUNT, INPUT, EQ, VERIFY,
+		0, MARK, "loop", 1, ADD, DUP, INPUT, IF, FIN, ENDIF, GOTO, "loop"`, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prog, err := parser.Parse(tokens)
+	if err != nil {
+		t.Fatal(err)
+	}
+	script, err := Compile(&prog)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jobs := make([]Job, n)
+	for i := range jobs {
+		input := int64(i%20 + 1)
+		ctx := &MockContext{TxAmount: input}
+		if i%7 == 6 {
+			ctx.TxAmount++
+		}
+		jobs[i] = Job{Script: script, Input: intToken(input), Context: ctx}
+	}
+	return jobs
+}
+
+func TestRunBatch(t *testing.T) {
+	jobs := batchJobs(t, 1000)
+	falsy, _ := parser.Parse([]lexer.Token{{TokenType: lexer.TypeBOOLEAN, Value: false}})
+	jobs[3] = Job{Program: &falsy}
+
+	results, stats := RunBatch(jobs, BatchConfig{Config: Config{Gas: 10000}, Workers: 8})
+	passed := 0
+	for i, result := range results {
+		want := i%7 != 6 && i != 3
+		if (result.Err == nil) != want || result.Skipped {
+			t.Fatalf("job %d: err %v, skipped %v, want pass %v", i, result.Err, result.Skipped, want)
+		}
+		if want {
+			passed++
+			if result.Last.Value != int64(i%20+1) {
+				t.Errorf("job %d: left %v, want %d", i, result.Last, i%20+1)
+			}
+		} else if !IsScriptFailure(result.Err) {
+			t.Errorf("job %d: %v is not a script failure", i, result.Err)
+		}
+	}
+	if stats.Passed != passed || stats.Failed != len(jobs)-passed || stats.Skipped != 0 || stats.FirstFailure != 3 {
+		t.Errorf("stats %+v, want %d passed and first failure 3", stats, passed)
+	}
+}
+
+func TestRunBatchStopOnFailure(t *testing.T) {
+	jobs := batchJobs(t, 1000)
+	results, stats := RunBatch(jobs, BatchConfig{Workers: 8, StopOnFailure: true})
+	if stats.FirstFailure != 6 {
+		t.Fatalf("first failure %d, want 6", stats.FirstFailure)
+	}
+	if stats.Skipped == 0 || stats.Passed+stats.Failed+stats.Skipped != len(jobs) {
+		t.Errorf("stats %+v, want skipped jobs", stats)
+	}
+	for i, result := range results[:stats.FirstFailure] {
+		if result.Err != nil || result.Skipped {
+			t.Errorf("job %d before the first failure: err %v, skipped %v", i, result.Err, result.Skipped)
+		}
+	}
+}
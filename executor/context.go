@@ -0,0 +1,121 @@
+// Copyright 2018 <kassCrypto@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this
+// software and associated documentation files (the "Software"), to deal in the Software
+// without restriction, including without limitation the rights to use, copy, modify,
+// merge, publish, distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to the following
+// conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies
+// or substantial portions of the Software.
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+// INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A
+// PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT
+// HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF
+// CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+// OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package executor
+
+import "splashcode/lexer"
+
+// TxContext exposes the transaction a program is run against, its
+// values are the implicit variables pushed by AMOUNT, SENDER,
+// RECIPIENT, TIMESTAMP, NONCE and HEIGHT.
+type TxContext interface {
+	Amount() int64      // Amount transferred
+	Sender() string     // Address of the sender
+	Recipient() string  // Address of the recipient
+	Timestamp() int64   // Unix time of the block
+	Nonce() int64       // Nonce of the transaction
+	BlockHeight() int64 // Height of the block
+	InputHeight() int64 // Height of the block holding the output being spent
+
+	// SigningDigest is the message signatures are checked against
+	// by CHECKSIG, usually a hash of the transaction.
+	SigningDigest() []byte
+}
+
+// MockContext is a TxContext with fixed values, it allows programs
+// to be run without a chain.
+type MockContext struct {
+	TxAmount      int64
+	TxSender      string
+	TxRecipient   string
+	TxTimestamp   int64
+	TxNonce       int64
+	TxBlockHeight int64
+	TxInputHeight int64
+	TxDigest      []byte
+}
+
+func (ctx *MockContext) Amount() int64         { return ctx.TxAmount }
+func (ctx *MockContext) Sender() string        { return ctx.TxSender }
+func (ctx *MockContext) Recipient() string     { return ctx.TxRecipient }
+func (ctx *MockContext) Timestamp() int64      { return ctx.TxTimestamp }
+func (ctx *MockContext) Nonce() int64          { return ctx.TxNonce }
+func (ctx *MockContext) BlockHeight() int64    { return ctx.TxBlockHeight }
+func (ctx *MockContext) InputHeight() int64    { return ctx.TxInputHeight }
+func (ctx *MockContext) SigningDigest() []byte { return ctx.TxDigest }
+
+// contextValue returns the token the keyword tokenType pushes from
+// the transaction context.
+func contextValue(ctx TxContext, tokenType int) (lexer.Token, *Error) {
+	if ctx == nil {
+		return lexer.Token{}, newError(ErrNoContext, "%s needs a transaction context", lexer.TokenTypeToString(tokenType))
+	}
+	switch tokenType {
+	case lexer.TypeAMOUNT:
+		return lexer.Token{TokenType: lexer.TypeINT, Value: ctx.Amount()}, nil
+	case lexer.TypeSENDER:
+		return lexer.Token{TokenType: lexer.TypeSTRING, Value: ctx.Sender()}, nil
+	case lexer.TypeRECIPIENT:
+		return lexer.Token{TokenType: lexer.TypeSTRING, Value: ctx.Recipient()}, nil
+	case lexer.TypeTIMESTAMP:
+		return lexer.Token{TokenType: lexer.TypeINT, Value: ctx.Timestamp()}, nil
+	case lexer.TypeNONCE:
+		return lexer.Token{TokenType: lexer.TypeINT, Value: ctx.Nonce()}, nil
+	default:
+		return lexer.Token{TokenType: lexer.TypeINT, Value: ctx.BlockHeight()}, nil
+	}
+}
+
+// LockTimeThreshold splits the values of CHECKLOCKTIME like Bitcoin,
+// smaller values are block heights, larger values are unix times.
+const LockTimeThreshold = 500000000
+
+// checkLock reads the INT at the top of the stack without popping
+// it, and fails the script if the CHECKLOCKTIME or CHECKSEQUENCE
+// lock given in op has not expired.
+func checkLock(vm *machine, ctx TxContext, op int) *Error {
+	if len(vm.stack) < 1 {
+		return newError(ErrStackUnderflow, "need 1 element, stack has 0")
+	}
+	lock, ok := vm.stack.Read().Value.(int64)
+	if !ok || vm.stack.Read().TokenType != lexer.TypeINT {
+		return newError(ErrTypeMismatch, "expected an INT, got %v", vm.stack.Read())
+	}
+	if lock < 0 {
+		return newError(ErrScriptFailed, "negative lock %d", lock)
+	}
+	if ctx == nil {
+		return newError(ErrNoContext, "%s needs a transaction context", lexer.TokenTypeToString(op))
+	}
+
+	switch {
+	case op == lexer.TypeCHECKSEQUENCE:
+		if age := ctx.BlockHeight() - ctx.InputHeight(); age < lock {
+			return newError(ErrScriptFailed, "output is %d blocks old, locked for %d", age, lock)
+		}
+	case lock < LockTimeThreshold:
+		if ctx.BlockHeight() < lock {
+			return newError(ErrScriptFailed, "block height %d, locked until %d", ctx.BlockHeight(), lock)
+		}
+	default:
+		if ctx.Timestamp() < lock {
+			return newError(ErrScriptFailed, "time %d, locked until %d", ctx.Timestamp(), lock)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+// Copyright 2018 <kassCrypto@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this
+// software and associated documentation files (the "Software"), to deal in the Software
+// without restriction, including without limitation the rights to use, copy, modify,
+// merge, publish, distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to the following
+// conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies
+// or substantial portions of the Software.
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+// INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A
+// PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT
+// HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF
+// CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+// OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package executor
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"encoding/hex"
+	"splashcode/lexer"
+)
+
+// byteValue reads a BYTES token, or a hex STRING token as bytes.
+func byteValue(token lexer.Token) ([]byte, *Error) {
+	if b, ok := token.Value.([]byte); ok && token.TokenType == lexer.TypeBYTES {
+		return b, nil
+	}
+	s, ok := token.Value.(string)
+	if !ok || token.TokenType != lexer.TypeSTRING {
+		return nil, newError(ErrTypeMismatch, "expected BYTES or a hex STRING, got %v", token)
+	}
+	buf, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, newError(ErrTypeMismatch, "invalid hex STRING %q", s)
+	}
+	return buf, nil
+}
+
+// checkSig pops a public key and then a signature, and reports
+// whether the signature is valid for the signing digest of the
+// transaction context.
+func checkSig(vm *machine, ctx TxContext) (bool, *Error) {
+	toks, err := popTokens(vm, 2)
+	if err != nil {
+		return false, err
+	}
+	if ctx == nil {
+		return false, newError(ErrNoContext, "no signing digest to verify")
+	}
+	pub, err := byteValue(toks[0])
+	if err != nil {
+		return false, err
+	}
+	sig, err := byteValue(toks[1])
+	if err != nil {
+		return false, err
+	}
+	return verifySignature(pub, sig, ctx.SigningDigest()), nil
+}
+
+// MaxMultisigKeys is the most keys CHECKMULTISIG accepts.
+const MaxMultisigKeys = 20
+
+// checkMultisig pops N, N public keys, M and M signatures, and
+// reports whether every signature is valid for the signing digest.
+// Like Bitcoin, signatures must be in the same order as their keys,
+// each key is tried once and only against the next signature.
+func checkMultisig(vm *machine, ctx TxContext) (bool, *Error) {
+	pubs, err := popCounted(vm, MaxMultisigKeys)
+	if err != nil {
+		return false, err
+	}
+	sigs, err := popCounted(vm, len(pubs))
+	if err != nil {
+		return false, err
+	}
+	if ctx == nil {
+		return false, newError(ErrNoContext, "no signing digest to verify")
+	}
+	digest := ctx.SigningDigest()
+
+	// Each signature must match a key after the key that matched
+	// the signature before it
+	k := 0
+	for s, sig := range sigs {
+		for {
+			// Not enough keys left for the remaining signatures
+			if len(pubs)-k < len(sigs)-s {
+				return false, nil
+			}
+			k++
+			if verifySignature(pubs[k-1], sig, digest) {
+				break
+			}
+		}
+	}
+	return true, nil
+}
+
+// popCounted pops an INT count, at most max, and then that many
+// BYTES or hex STRING tokens. The tokens are returned in the order they were
+// pushed.
+func popCounted(vm *machine, max int) ([][]byte, *Error) {
+	toks, err := popTokens(vm, 1)
+	if err != nil {
+		return nil, err
+	}
+	count, _, isInt, err := numericValue(toks[0])
+	if err == nil && !isInt {
+		err = newError(ErrTypeMismatch, "expected an INT count, got %v", toks[0])
+	}
+	if err != nil {
+		return nil, err
+	}
+	if count < 0 || count > int64(max) {
+		return nil, newError(ErrInvalidProgram, "count %d must be between 0 and %d", count, max)
+	}
+	if toks, err = popTokens(vm, int(count)); err != nil {
+		return nil, err
+	}
+	values := make([][]byte, count)
+	for i, token := range toks {
+		if values[len(toks)-1-i], err = byteValue(token); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+// verifySignature checks sig is a signature of digest by pub. The
+// algorithm is chosen by the length of the key:
+//
+//	32 bytes      Ed25519, sig is 64 bytes
+//	33, 65 bytes  ECDSA P-256 compressed or uncompressed point,
+//	              sig is ASN.1 DER encoded
+//
+// Malformed keys and signatures are invalid, they are not errors.
+func verifySignature(pub []byte, sig []byte, digest []byte) bool {
+	switch len(pub) {
+	case ed25519.PublicKeySize:
+		return len(sig) == ed25519.SignatureSize && ed25519.Verify(pub, digest, sig)
+	case 33, 65:
+		curve := elliptic.P256()
+		if len(pub) == 33 {
+			// Decompress the point, the uncompressed form is
+			// parsed and checked below
+			x, y := elliptic.UnmarshalCompressed(curve, pub)
+			if x == nil {
+				return false
+			}
+			pub = make([]byte, 65)
+			pub[0] = 4
+			x.FillBytes(pub[1:33])
+			y.FillBytes(pub[33:])
+		}
+		key, err := ecdsa.ParseUncompressedPublicKey(curve, pub)
+		if err != nil {
+			return false
+		}
+		return ecdsa.VerifyASN1(key, digest, sig)
+	default:
+		return false
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright 2018 <kassCrypto@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this
+// software and associated documentation files (the "Software"), to deal in the Software
+// without restriction, including without limitation the rights to use, copy, modify,
+// merge, publish, distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to the following
+// conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies
+// or substantial portions of the Software.
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+// INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A
+// PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT
+// HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF
+// CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+// OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package executor
+
+import (
+	"fmt"
+	"splashcode/lexer"
+	"splashcode/parser"
+)
+
+// ErrorKind identifies why the execution of a program stopped.
+type ErrorKind int
+
+const (
+	ErrStackUnderflow = ErrorKind(iota) // Not enough elements in stack
+	ErrTypeMismatch   = ErrorKind(iota) // An element had the wrong type for the operation
+	ErrUnknownLabel   = ErrorKind(iota) // GOTO to a marker or function that doesn't exist
+	ErrDivisionByZero = ErrorKind(iota) // DIV with zero as the divisor
+	ErrInvalidProgram = ErrorKind(iota) // Malformed program, e.g a missing operand or jump target
+	ErrOutOfGas       = ErrorKind(iota) // The gas budget was spent before the program finished
+	ErrPolicy         = ErrorKind(iota) // A keyword or jump disabled by the execution policy
+	ErrCallDepth      = ErrorKind(iota) // Too many nested CALLs
+	ErrNoContext      = ErrorKind(iota) // A keyword needs a transaction context but none was given
+	ErrScriptFailed   = ErrorKind(iota) // A verification failed, e.g VERIFY or CHECKSIGVERIFY
+)
+
+func (kind ErrorKind) String() string {
+	switch kind {
+	case ErrStackUnderflow:
+		return "stack underflow"
+	case ErrTypeMismatch:
+		return "type mismatch"
+	case ErrUnknownLabel:
+		return "unknown label"
+	case ErrDivisionByZero:
+		return "division by zero"
+	case ErrInvalidProgram:
+		return "invalid program"
+	case ErrOutOfGas:
+		return "out of gas"
+	case ErrPolicy:
+		return "policy violation"
+	case ErrCallDepth:
+		return "call depth exceeded"
+	case ErrNoContext:
+		return "no transaction context"
+	case ErrScriptFailed:
+		return "script failed"
+	default:
+		return "unknown error"
+	}
+}
+
+// Error is returned by Run when a program cannot continue, it
+// records the index, opcode and source position of the token that
+// failed.
+type Error struct {
+	Kind   ErrorKind
+	Index  int
+	Opcode int
+	Pos    lexer.Position
+	Msg    string
+}
+
+func (err *Error) Error() string {
+	s := fmt.Sprintf("%v at token %d (%s)", err.Kind, err.Index, lexer.TokenTypeToString(err.Opcode))
+	if err.Pos.Line > 0 {
+		s = err.Pos.String() + ": " + s
+	}
+	if err.Msg != "" {
+		s += ": " + err.Msg
+	}
+	return s
+}
+
+// IsScriptFailure reports whether err is a script that ran but
+// failed a verification, such as VERIFY, EQUALVERIFY, RETURN_FAIL,
+// CHECKSIGVERIFY or a timelock, the opcode is in err.Opcode. Any
+// other error is a program that could not be run.
+func IsScriptFailure(err error) bool {
+	e, ok := err.(*Error)
+	return ok && e.Kind == ErrScriptFailed
+}
+
+// newError creates an Error of the given kind, the token index,
+// opcode and position are filled in by Run.
+func newError(kind ErrorKind, format string, args ...interface{}) *Error {
+	return &Error{Kind: kind, Msg: fmt.Sprintf(format, args...)}
+}
+
+// at records the failing token on the error.
+func (err *Error) at(index int, token lexer.Token) *Error {
+	err.Index, err.Opcode, err.Pos = index, token.TokenType, token.Pos
+	return err
+}
+
+// verifyError converts an error from parser.Verify to an Error.
+func verifyError(prog *parser.Program, err error) *Error {
+	e := newError(ErrInvalidProgram, "%v", err)
+	if perr, ok := err.(*parser.Error); ok {
+		e.Msg = perr.Msg
+		if perr.Index >= 0 && perr.Index < len(prog.Tokens) {
+			e.at(perr.Index, prog.Tokens[perr.Index])
+		}
+	}
+	return e
+}
@@ -0,0 +1,102 @@
+// Copyright 2018 <kassCrypto@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this
+// software and associated documentation files (the "Software"), to deal in the Software
+// without restriction, including without limitation the rights to use, copy, modify,
+// merge, publish, distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to the following
+// conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies
+// or substantial portions of the Software.
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+// INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A
+// PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT
+// HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF
+// CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+// OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package executor
+
+import (
+	"splashcode/lexer"
+	"splashcode/parser"
+)
+
+// Costs maps a token type to the amount of gas it costs to
+// execute, token types missing from the table cost DefaultCost.
+type Costs map[int]uint64
+
+// DefaultCost is charged for any token type not found in Costs.
+const DefaultCost = 1
+
+// DefaultCosts is the cost table used when a Config has none.
+var DefaultCosts = Costs{
+	lexer.TypeGOTO:   2,
+	lexer.TypeMARK:   2,
+	lexer.TypeIF:     2,
+	lexer.TypeFUNC:   2,
+	lexer.TypeCALL:   3,
+	lexer.TypeRETURN: 2,
+	lexer.TypePICK:   2,
+	lexer.TypeROLL:   3,
+	lexer.TypeMUL:    2,
+	lexer.TypeDIV:    3,
+	lexer.TypeHASH:   50,
+
+	lexer.TypeSHA512:  50,
+	lexer.TypeSHA3:    50,
+	lexer.TypeHASH160: 50,
+	lexer.TypeHASH256: 100,
+
+	lexer.TypeCHECKSIG:       100,
+	lexer.TypeCHECKSIGVERIFY: 100,
+	lexer.TypeCHECKMULTISIG:  100 * MaxMultisigKeys,
+	lexer.TypePRINT:          5,
+	lexer.TypePRINTLN:        5,
+}
+
+// Cost returns the gas charged for executing the given token type.
+func (costs Costs) Cost(tokenType int) uint64 {
+	if cost, ok := costs[tokenType]; ok {
+		return cost
+	}
+	return DefaultCost
+}
+
+// DefaultMaxCallDepth is used when a Config has no MaxCallDepth.
+const DefaultMaxCallDepth = 64
+
+// Config holds the settings of a single execution.
+type Config struct {
+	Gas        uint64 // Gas budget, 0 means unlimited
+	Costs      Costs  // Cost per token type, nil uses DefaultCosts
+	StackTrace bool   // Print the stack and token before each step
+
+	// MaxCallDepth limits how many CALLs may be nested, 0 uses
+	// DefaultMaxCallDepth.
+	MaxCallDepth int
+
+	// Context is the transaction the program is run against, it
+	// may be nil if the program doesn't use it.
+	Context TxContext
+
+	// Policy is enforced on every token executed, so programs
+	// that skipped parser.ParseWithPolicy are still rejected.
+	Policy parser.Policy
+
+	// Stack is the stack the program starts with, it is copied so
+	// the run doesn't modify it.
+	Stack parser.Stack
+
+	// PayToScriptHash makes RunPair run the redeem script when the
+	// locking script is a pay-to-script-hash, see IsPayToScriptHash.
+	PayToScriptHash bool
+}
+
+// Result is the outcome of an execution.
+type Result struct {
+	Stack   parser.Stack // Stack left after popping Last
+	Last    lexer.Token  // Last token in stack
+	GasUsed uint64
+}
@@ -0,0 +1,152 @@
+// Copyright 2018 <kassCrypto@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this
+// software and associated documentation files (the "Software"), to deal in the Software
+// without restriction, including without limitation the rights to use, copy, modify,
+// merge, publish, distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to the following
+// conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies
+// or substantial portions of the Software.
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+// INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A
+// PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT
+// HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF
+// CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+// OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package executor
+
+import (
+	"bytes"
+	"math"
+	"splashcode/lexer"
+)
+
+// boolToken wraps b in a BOOLEAN token.
+func boolToken(b bool) lexer.Token {
+	return lexer.Token{TokenType: lexer.TypeBOOLEAN, Value: b}
+}
+
+// booleanValue reads a BOOLEAN token.
+func booleanValue(token lexer.Token) (bool, *Error) {
+	b, ok := token.Value.(bool)
+	if !ok || token.TokenType != lexer.TypeBOOLEAN {
+		return false, newError(ErrTypeMismatch, "expected a BOOLEAN, got %v", token)
+	}
+	return b, nil
+}
+
+// isTruthy reports whether a token counts as TRUE for VERIFY. FALSE,
+// zero, the empty STRING and BYTES that are all zero are false, any
+// other token is true.
+func isTruthy(token lexer.Token) bool {
+	switch v := token.Value.(type) {
+	case bool:
+		return v
+	case int64:
+		return v != 0
+	case float64:
+		return v != 0
+	case string:
+		return v != ""
+	case []byte:
+		for _, b := range v {
+			if b != 0 {
+				return true
+			}
+		}
+		return false
+	default:
+		return false
+	}
+}
+
+// tokenCompare will compare the first token with the second using
+// the LT, GT, LTE or GTE keyword given in op. Numbers are promoted
+// like in tokenAddition.
+func tokenCompare(op int, tokenA lexer.Token, tokenB lexer.Token) (result lexer.Token, err *Error) {
+	ia, ib, fa, fb, isInt, err := numericOperands(tokenA, tokenB)
+	if err != nil {
+		return
+	}
+
+	var less, equal bool
+	if isInt {
+		less, equal = ia < ib, ia == ib
+	} else {
+		less, equal = fa < fb, fa == fb
+	}
+
+	switch op {
+	case lexer.TypeLT:
+		return boolToken(less), nil
+	case lexer.TypeGT:
+		return boolToken(!less && !equal && !isNaN(fa, fb)), nil
+	case lexer.TypeLTE:
+		return boolToken(less || equal), nil
+	default:
+		return boolToken(!less && !isNaN(fa, fb)), nil
+	}
+}
+
+// isNaN reports whether either float is NaN, NaN is neither less,
+// equal nor greater than any number.
+func isNaN(fa float64, fb float64) bool {
+	return math.IsNaN(fa) || math.IsNaN(fb)
+}
+
+// tokensEqual reports whether two tokens are equal. Numbers are
+// promoted like in tokenAddition, any other tokens must have the
+// same type and value.
+func tokensEqual(tokenA lexer.Token, tokenB lexer.Token) bool {
+	ia, ib, fa, fb, isInt, err := numericOperands(tokenA, tokenB)
+	if err == nil {
+		if isInt {
+			return ia == ib
+		}
+		return fa == fb
+	}
+	return tokensIdentical(tokenA, tokenB)
+}
+
+// tokensIdentical reports whether two tokens have the same type and
+// value, like IF compares them.
+func tokensIdentical(tokenA lexer.Token, tokenB lexer.Token) bool {
+	if tokenA.TokenType != tokenB.TokenType {
+		return false
+	}
+	a, aIsBytes := tokenA.Value.([]byte)
+	b, bIsBytes := tokenB.Value.([]byte)
+	if aIsBytes || bIsBytes {
+		return aIsBytes && bIsBytes && bytes.Equal(a, b)
+	}
+	return tokenA.Value == tokenB.Value
+}
+
+// tokenAnd will push TRUE if both boolean tokens are TRUE.
+func tokenAnd(tokenA lexer.Token, tokenB lexer.Token) (lexer.Token, *Error) {
+	a, err := booleanValue(tokenA)
+	if err != nil {
+		return lexer.Token{}, err
+	}
+	b, err := booleanValue(tokenB)
+	if err != nil {
+		return lexer.Token{}, err
+	}
+	return boolToken(a && b), nil
+}
+
+// tokenOr will push TRUE if either boolean token is TRUE.
+func tokenOr(tokenA lexer.Token, tokenB lexer.Token) (lexer.Token, *Error) {
+	a, err := booleanValue(tokenA)
+	if err != nil {
+		return lexer.Token{}, err
+	}
+	b, err := booleanValue(tokenB)
+	if err != nil {
+		return lexer.Token{}, err
+	}
+	return boolToken(a || b), nil
+}
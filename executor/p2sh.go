@@ -0,0 +1,100 @@
+// Copyright 2018 <kassCrypto@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this
+// software and associated documentation files (the "Software"), to deal in the Software
+// without restriction, including without limitation the rights to use, copy, modify,
+// merge, publish, distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to the following
+// conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies
+// or substantial portions of the Software.
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+// INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A
+// PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT
+// HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF
+// CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+// OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package executor
+
+import (
+	"splashcode/bytecode"
+	"splashcode/lexer"
+	"splashcode/parser"
+)
+
+// ScriptHashSize is the length of the HASH160 of a redeem script.
+const ScriptHashSize = 20
+
+// MaxRedeemScriptSize is the largest redeem script, in bytes of
+// bytecode, that RunPair will decode.
+const MaxRedeemScriptSize = 4096
+
+// ScriptHash returns the HASH160 of the bytecode of the redeem
+// script, which a pay-to-script-hash locking script is locked to.
+func ScriptHash(redeem *parser.Program) ([]byte, error) {
+	data, err := bytecode.Encode(redeem)
+	if err != nil {
+		return nil, err
+	}
+	return hashes[lexer.TypeHASH160](data), nil
+}
+
+// IsPayToScriptHash reports whether lock is a pay-to-script-hash
+// locking script, exactly
+//
+//	HASH160, 0x<20 byte script hash>, EQ
+//
+// and returns the script hash.
+func IsPayToScriptHash(lock *Script) ([]byte, bool) {
+	if len(lock.tokens) != 3 || lock.tokens[0].TokenType != lexer.TypeHASH160 || lock.tokens[2].TokenType != lexer.TypeEQ {
+		return nil, false
+	}
+	hash, ok := lock.tokens[1].Value.([]byte)
+	if !ok || lock.tokens[1].TokenType != lexer.TypeBYTES || len(hash) != ScriptHashSize {
+		return nil, false
+	}
+	return hash, true
+}
+
+// redeem decodes the redeem script on top of the stack left by the
+// unlocking script, and runs it on the rest of that stack with the
+// gas left and loops and functions disabled, like
+// parser.Transactional. The locking script has already checked its
+// hash.
+func (vm *machine) redeem(stack parser.Stack, config Config) error {
+	if len(stack) == 0 {
+		return newError(ErrStackUnderflow, "no redeem script")
+	}
+	stack, top := stack.Pop()
+	data, ok := top.Value.([]byte)
+	if !ok || top.TokenType != lexer.TypeBYTES {
+		return newError(ErrTypeMismatch, "redeem script must be BYTES, got %v", top)
+	}
+	if len(data) > MaxRedeemScriptSize {
+		return newError(ErrInvalidProgram, "redeem script is %d bytes, at most %d are allowed", len(data), MaxRedeemScriptSize)
+	}
+
+	prog, err := bytecode.Decode(data)
+	if err != nil {
+		return newError(ErrInvalidProgram, "redeem script: %v", err)
+	}
+	script, err := Compile(&prog)
+	if err != nil {
+		return inScript("redeem script", err)
+	}
+
+	// The redeem script comes from the spender, it must terminate
+	// even when there is no gas budget
+	config.Policy.NoFunctions, config.Policy.NoLoops = true, true
+	if err := config.Policy.Check(&prog); err != nil {
+		return inScript("redeem script", verifyError(&prog, err))
+	}
+
+	vm.script, vm.stack, vm.marks = script, stack, nil
+	if err := vm.run(lexer.Token{}, config); err != nil {
+		return inScript("redeem script", err)
+	}
+	return vm.checkTop("redeem script")
+}
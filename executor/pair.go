@@ -0,0 +1,88 @@
+// Copyright 2018 <kassCrypto@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this
+// software and associated documentation files (the "Software"), to deal in the Software
+// without restriction, including without limitation the rights to use, copy, modify,
+// merge, publish, distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to the following
+// conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies
+// or substantial portions of the Software.
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+// INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A
+// PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT
+// HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF
+// CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+// OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package executor
+
+import (
+	"fmt"
+	"splashcode/lexer"
+	"splashcode/parser"
+)
+
+// RunPair will run the unlocking script and then the locking script
+// on the stack it left behind, like the scriptSig and scriptPubKey
+// of a Bitcoin transaction. The unlocking script may only push
+// literals (parser.Unlocking), config.Policy applies to the locking
+// script and config.Stack is ignored. Both scripts share the gas
+// budget. The pair passes only if the locking script leaves a truthy
+// element on top of the stack, otherwise an ErrScriptFailed error is
+// returned.
+//
+// With config.PayToScriptHash set, a locking script matched by
+// IsPayToScriptHash must also be satisfied by its redeem script.
+func RunPair(unlock *Script, lock *Script, config Config) (Result, error) {
+	vm := newMachine(unlock, nil)
+	unlockConfig := config
+	unlockConfig.Policy = parser.Unlocking
+	if err := vm.run(lexer.Token{}, unlockConfig); err != nil {
+		return vm.result(err), inScript("unlocking script", err)
+	}
+
+	// The locking script may modify the elements of the stack, keep
+	// a copy for the redeem script
+	var unlocked parser.Stack
+	if config.PayToScriptHash {
+		unlocked = append(unlocked, vm.stack...)
+	}
+
+	vm.script, vm.marks = lock, nil
+	err := vm.run(lexer.Token{}, config)
+	if err != nil {
+		err = inScript("locking script", err)
+	} else {
+		err = vm.checkTop("locking script")
+	}
+	if _, ok := IsPayToScriptHash(lock); err == nil && ok && config.PayToScriptHash {
+		err = vm.redeem(unlocked, config)
+	}
+	return vm.result(err), err
+}
+
+// checkTop fails the script unless the run left a truthy element on
+// top of the stack, name is the script that was run.
+func (vm *machine) checkTop(name string) error {
+	if len(vm.stack) > 0 && isTruthy(vm.stack.Read()) {
+		return nil
+	}
+	e := newError(ErrScriptFailed, "%s left an empty stack", name)
+	if len(vm.stack) > 0 {
+		e.Msg = fmt.Sprintf("%s left %v on top of the stack", name, vm.stack.Read())
+	}
+	if n := len(vm.script.tokens); n > 0 {
+		e.at(n-1, vm.script.tokens[n-1])
+	}
+	return e
+}
+
+// inScript adds the name of the script that failed to err.
+func inScript(name string, err error) error {
+	if e, ok := err.(*Error); ok {
+		e.Msg = name + ": " + e.Msg
+	}
+	return err
+}
@@ -20,6 +20,9 @@ package executor
 
 import (
 	"crypto/sha256"
+	"crypto/sha3"
+	"crypto/sha512"
+	"encoding/binary"
 	"encoding/hex"
 	"fmt"
 	"splashcode/lexer"
@@ -28,237 +31,607 @@ import (
 
 // Run will execute the given program (parser.Program), any args
 // are passed into the input, and a stack trace maybe eneabled.
-func Run(prog *parser.Program, input lexer.Token, stackTrace bool) (parser.Stack, lexer.Token) {
+// An *Error is returned if the program cannot be executed.
+func Run(prog *parser.Program, input lexer.Token, stackTrace bool) (parser.Stack, lexer.Token, error) {
+	result, err := Execute(prog, input, Config{StackTrace: stackTrace})
+	return result.Stack, result.Last, err
+}
+
+// Execute runs the program like Run, charging gas for every token
+// executed. When the budget in config.Gas runs out execution stops
+// with an ErrOutOfGas error, result.GasUsed reports the gas spent.
+// The program is compiled, and so verified, before it is run.
+func Execute(prog *parser.Program, input lexer.Token, config Config) (Result, error) {
+	script, err := compileWithPolicy(prog, config.Policy)
+	if err != nil {
+		return Result{Stack: make(parser.Stack, 0)}, err
+	}
+	return script.Run(input, config)
+}
+
+// Run executes the script like Execute. Every run has its own stack
+// and markers, the script itself is only read.
+func (script *Script) Run(input lexer.Token, config Config) (Result, error) {
+	vm := newMachine(script, config.Stack)
+	err := vm.run(input, config)
+	return vm.result(err), err
+}
+
+// run executes vm.script on the stack of vm, the gas used is added
+// to vm.gasUsed.
+func (vm *machine) run(input lexer.Token, config Config) error {
+	var i, at int
+	var token lexer.Token
+
+	costs := config.Costs
+	if costs == nil {
+		costs = DefaultCosts
+	}
+	maxCallDepth := config.MaxCallDepth
+	if maxCallDepth == 0 {
+		maxCallDepth = DefaultMaxCallDepth
+	}
+
+	// Return addresses of the active CALLs, each is the index of
+	// the label following the CALL.
+	var calls []int
+
+	// Values from the caller are checked once, every operation
+	// can then rely on the stack holding values a literal can have
+	if e := checkValue(input); e != nil {
+		return e
+	}
+	for _, val := range vm.stack {
+		if e := checkValue(val); e != nil {
+			return e
+		}
+	}
+
 ExecutionLoop:
 	// Loop through all tokens in program
-	for i := 0; i < len(prog.Tokens); i++ {
+	for i = 0; i < len(vm.script.tokens); i++ {
+
+		at, token = i, vm.script.tokens[i]
+
+		cost := costs.Cost(token.TokenType)
+		if config.Gas != 0 && config.Gas-vm.gasUsed < cost {
+			e := newError(ErrOutOfGas, "used %d of %d gas, %d more needed", vm.gasUsed, config.Gas, cost)
+			return e.at(at, token)
+		}
+		vm.gasUsed += cost
 
-		token := prog.Tokens[i]
+		if config.StackTrace {
+			fmt.Println("STRACT::STACK", vm.stack)
+			fmt.Println("STRACE::TOKEN", lexer.TokenTypeToString(token.TokenType), token.Value, "at", token.Pos)
+		}
 
-		if stackTrace {
-			fmt.Println("STRACT::STACK", prog.Stack)
-			fmt.Println("STRACE::TOKEN", lexer.TokenTypeToString(token.TokenType), token.Value)
+		var e *Error
+		if !config.Policy.Allows(token.TokenType) {
+			e = newError(ErrPolicy, "%s is disabled", lexer.TokenTypeToString(token.TokenType))
+			return e.at(at, token)
 		}
 
 		switch token.TokenType {
 		case lexer.TypeGOTO:
 			// Move execution cursor 'i' to marker
-			label := prog.Tokens[i+1].Value.(string)
-			i = prog.Markers[label]
+			var label string
+			if label, e = labelOperand(vm, i); e != nil {
+				break
+			}
+			marker, ok := vm.marker(label)
+			if !ok {
+				e = newError(ErrUnknownLabel, "no marker or function named %q", label)
+				break
+			}
+			if !config.Policy.AllowsJump(i, marker) {
+				e = newError(ErrPolicy, "backward GOTO to %q is disabled", label)
+				break
+			}
+			i = marker
 			break
 		case lexer.TypeMARK:
 			// Add/Udate marker to "i + 1"
-			label := prog.Tokens[i+1].Value.(string)
-			prog.Markers[label] = i + 1
+			var label string
+			if label, e = labelOperand(vm, i); e != nil {
+				break
+			}
+			vm.mark(label, i+1)
 			i++
 			break
 		case lexer.TypeIF:
-			var TokeA, TokeB lexer.Token
-			prog.Stack, TokeA = prog.Stack.Pop()
-			prog.Stack, TokeB = prog.Stack.Pop()
-			if TokeA.TokenType != TokeB.TokenType ||
-				TokeA.Value != TokeB.Value {
-				i = token.Value.(int)
+			var toks []lexer.Token
+			if toks, e = popTokens(vm, 2); e != nil {
+				break
+			}
+			if !tokensIdentical(toks[0], toks[1]) {
+				i, e = jumpTarget(vm, token)
+			}
+			break
+		case lexer.TypeIFTRUE:
+			var toks []lexer.Token
+			var ok bool
+			if toks, e = popTokens(vm, 1); e != nil {
+				break
 			}
+			if ok, e = booleanValue(toks[0]); e == nil && !ok {
+				i, e = jumpTarget(vm, token)
+			}
+			break
+		case lexer.TypeELSE:
+			// The IF succeeded, skip the ELSE branch
+			i, e = jumpTarget(vm, token)
 			break
 		case lexer.TypeENDIF:
 			//NOTHING
 			break
 		case lexer.TypeFUNC:
 			// Move execution cursor 'i' to marker
-			i = token.Value.(int)
+			i, e = jumpTarget(vm, token)
 			break
 		case lexer.TypeENDFUNC:
-			// Nothing
+			// Reaching the end of a called function returns from it
+			if len(calls) > 0 {
+				i, calls = calls[len(calls)-1], calls[:len(calls)-1]
+			}
+			break
+		case lexer.TypeCALL:
+			// Save the return address and move execution cursor 'i'
+			// to the function
+			var label string
+			if label, e = labelOperand(vm, i); e != nil {
+				break
+			}
+			marker, ok := vm.marker(label)
+			if !ok {
+				e = newError(ErrUnknownLabel, "no marker or function named %q", label)
+				break
+			}
+			if len(calls) >= maxCallDepth {
+				e = newError(ErrCallDepth, "more than %d nested calls", maxCallDepth)
+				break
+			}
+			calls = append(calls, i+1)
+			i = marker
+			break
+		case lexer.TypeRETURN:
+			// Move execution cursor 'i' back to the caller
+			if len(calls) == 0 {
+				e = newError(ErrInvalidProgram, "RETURN outside of a called function")
+				break
+			}
+			i, calls = calls[len(calls)-1], calls[:len(calls)-1]
 			break
 		case lexer.TypeDUP:
-			val := prog.Stack.Read()
-			prog.Stack = prog.Stack.Push(val)
+			if len(vm.stack) < 1 {
+				e = newError(ErrStackUnderflow, "DUP needs 1 element")
+				break
+			}
+			val := vm.stack.Read()
+			vm.stack = vm.stack.Push(val)
 			break
 		case lexer.TypeDROP:
-			prog.Stack, _ = prog.Stack.Pop()
+			_, e = popTokens(vm, 1)
 			break
 		case lexer.TypePICK:
-			count := prog.Tokens[i+1].Value.(int)
-			val := prog.Stack.Pick(count)
-			prog.Stack = prog.Stack.Push(val)
+			var count int
+			if count, e = countOperand(vm, i); e != nil {
+				break
+			}
+			val := vm.stack.Pick(count)
+			vm.stack = vm.stack.Push(val)
+			i++
 			break
 		case lexer.TypeROLL:
-			count := prog.Tokens[i+1].Value.(int)
-			val := prog.Stack.Pick(count)
-			prog.Stack = prog.Stack.Push(val)
-			prog.Stack = prog.Stack.Delete(count)
+			var count int
+			if count, e = countOperand(vm, i); e != nil {
+				break
+			}
+			val := vm.stack.Pick(count)
+			vm.stack = vm.stack.Delete(count)
+			vm.stack = vm.stack.Push(val)
+			i++
 			break
 		case lexer.TypeADD:
-			var TokeA, TokeB lexer.Token
-			prog.Stack, TokeA = prog.Stack.Pop()
-			prog.Stack, TokeB = prog.Stack.Pop()
-			prog.Stack = prog.Stack.Push(tokenAddition(TokeA, TokeB))
+			e = binaryOperation(vm, tokenAddition)
 			break
 		case lexer.TypeSUB:
-			var TokeA, TokeB lexer.Token
-			prog.Stack, TokeA = prog.Stack.Pop()
-			prog.Stack, TokeB = prog.Stack.Pop()
-			prog.Stack = prog.Stack.Push(tokenSubtraction(TokeA, TokeB))
+			e = binaryOperation(vm, tokenSubtraction)
 			break
 		case lexer.TypeMUL:
-			var TokeA, TokeB lexer.Token
-			prog.Stack, TokeA = prog.Stack.Pop()
-			prog.Stack, TokeB = prog.Stack.Pop()
-			prog.Stack = prog.Stack.Push(tokenMultiply(TokeA, TokeB))
+			e = binaryOperation(vm, tokenMultiply)
 			break
 		case lexer.TypeDIV:
-			var TokeA, TokeB lexer.Token
-			prog.Stack, TokeA = prog.Stack.Pop()
-			prog.Stack, TokeB = prog.Stack.Pop()
-			prog.Stack = prog.Stack.Push(tokenDivide(TokeA, TokeB))
+			e = binaryOperation(vm, tokenDivide)
+			break
+		case lexer.TypeLT, lexer.TypeGT, lexer.TypeLTE, lexer.TypeGTE:
+			e = binaryOperation(vm, func(tokenB, tokenA lexer.Token) (lexer.Token, *Error) {
+				return tokenCompare(token.TokenType, tokenA, tokenB)
+			})
+			break
+		case lexer.TypeEQ:
+			e = binaryOperation(vm, func(tokenB, tokenA lexer.Token) (lexer.Token, *Error) {
+				return boolToken(tokensEqual(tokenA, tokenB)), nil
+			})
+			break
+		case lexer.TypeNEQ:
+			e = binaryOperation(vm, func(tokenB, tokenA lexer.Token) (lexer.Token, *Error) {
+				return boolToken(!tokensEqual(tokenA, tokenB)), nil
+			})
+			break
+		case lexer.TypeAND:
+			e = binaryOperation(vm, tokenAnd)
+			break
+		case lexer.TypeOR:
+			e = binaryOperation(vm, tokenOr)
+			break
+		case lexer.TypeNOT:
+			var toks []lexer.Token
+			var ok bool
+			if toks, e = popTokens(vm, 1); e != nil {
+				break
+			}
+			if ok, e = booleanValue(toks[0]); e != nil {
+				break
+			}
+			vm.stack = vm.stack.Push(boolToken(!ok))
+			break
+		case lexer.TypeHASH, lexer.TypeSHA512, lexer.TypeSHA3, lexer.TypeHASH160, lexer.TypeHASH256:
+			var toks []lexer.Token
+			var result lexer.Token
+			if toks, e = popTokens(vm, 1); e != nil {
+				break
+			}
+			if result, e = tokenHash(toks[0], hashes[token.TokenType]); e != nil {
+				break
+			}
+			vm.stack = vm.stack.Push(result)
+
+		case lexer.TypeCHECKSIG:
+			var ok bool
+			if ok, e = checkSig(vm, config.Context); e != nil {
+				break
+			}
+			vm.stack = vm.stack.Push(boolToken(ok))
 			break
-		case lexer.TypeHASH:
-			var TokeA lexer.Token
-			prog.Stack, TokeA = prog.Stack.Pop()
-			prog.Stack = prog.Stack.Push(tokenHash(TokeA))
+		case lexer.TypeCHECKSIGVERIFY:
+			var ok bool
+			if ok, e = checkSig(vm, config.Context); e == nil && !ok {
+				e = newError(ErrScriptFailed, "invalid signature")
+			}
+			break
+		case lexer.TypeCHECKMULTISIG:
+			var ok bool
+			if ok, e = checkMultisig(vm, config.Context); e != nil {
+				break
+			}
+			vm.stack = vm.stack.Push(boolToken(ok))
+			break
+		case lexer.TypeTOHEX, lexer.TypeFROMHEX, lexer.TypeTOINT, lexer.TypeTOBYTES:
+			var toks []lexer.Token
+			var result lexer.Token
+			if toks, e = popTokens(vm, 1); e != nil {
+				break
+			}
+			if result, e = tokenConvert(token.TokenType, toks[0]); e != nil {
+				break
+			}
+			vm.stack = vm.stack.Push(result)
+			break
+		case lexer.TypeCHECKLOCKTIME, lexer.TypeCHECKSEQUENCE:
+			e = checkLock(vm, config.Context, token.TokenType)
+			break
+		case lexer.TypeVERIFY:
+			var toks []lexer.Token
+			if toks, e = popTokens(vm, 1); e == nil && !isTruthy(toks[0]) {
+				e = newError(ErrScriptFailed, "%v is not true", toks[0])
+			}
+			break
+		case lexer.TypeEQUALVERIFY:
+			var toks []lexer.Token
+			if toks, e = popTokens(vm, 2); e == nil && !tokensEqual(toks[1], toks[0]) {
+				e = newError(ErrScriptFailed, "%v is not equal to %v", toks[1], toks[0])
+			}
+			break
+		case lexer.TypeRETURNFAIL:
+			e = newError(ErrScriptFailed, "RETURN_FAIL")
 
 		case lexer.TypeFIN:
 			break ExecutionLoop
 		case lexer.TypeINPUT:
-			prog.Stack = prog.Stack.Push(input)
+			vm.stack = vm.stack.Push(input)
+			break
+		case lexer.TypeAMOUNT, lexer.TypeSENDER, lexer.TypeRECIPIENT,
+			lexer.TypeTIMESTAMP, lexer.TypeNONCE, lexer.TypeHEIGHT:
+			var val lexer.Token
+			if val, e = contextValue(config.Context, token.TokenType); e != nil {
+				break
+			}
+			vm.stack = vm.stack.Push(val)
 			break
 		case lexer.TypePRINT:
-			fmt.Print(prog.Stack.Read().Value)
+			if len(vm.stack) < 1 {
+				e = newError(ErrStackUnderflow, "PRINT needs 1 element")
+				break
+			}
+			fmt.Print(vm.stack.Read().ValueString())
 			break
 		case lexer.TypePRINTLN:
-			fmt.Println(prog.Stack.Read().Value)
+			if len(vm.stack) < 1 {
+				e = newError(ErrStackUnderflow, "PRINTLN needs 1 element")
+				break
+			}
+			fmt.Println(vm.stack.Read().ValueString())
 		default:
-			prog.Stack = prog.Stack.Push(token)
+			// Push a copy of BYTES, the stack is returned to the
+			// caller and must not share memory with the script
+			if b, ok := token.Value.([]byte); ok {
+				token.Value = append([]byte{}, b...)
+			}
+			vm.stack = vm.stack.Push(token)
 			break
 		}
-	}
 
-	// Return last token
-	if len(prog.Stack) > 0 {
-		return prog.Stack.Pop()
+		if e != nil {
+			return e.at(at, token)
+		}
 	}
-	return prog.Stack, lexer.Token{}
+	return nil
 }
 
-// tokenAddition will add two tokens together and will return the
-// result.
-func tokenAddition(tokenA lexer.Token, tokenB lexer.Token) (result lexer.Token) {
-
-	aIsInt := tokenA.TokenType == lexer.TypeINT
-	bIsInt := tokenB.TokenType == lexer.TypeINT
+// checkValue returns an error for a token given by the caller, as
+// the input or in Config.Stack, with a value no token can have.
+func checkValue(token lexer.Token) *Error {
+	switch token.Value.(type) {
+	case nil, int, int64, float64, string, bool, []byte:
+		return nil
+	}
+	return newError(ErrTypeMismatch, "%s has a %T value", lexer.TokenTypeToString(token.TokenType), token.Value)
+}
 
-	if aIsInt && bIsInt {
-		result.TokenType = lexer.TypeINT
-		result.Value = tokenA.Value.(int64) + tokenB.Value.(int64)
-		return
+// popTokens pops n tokens from the stack, the most recently pushed
+// token is first in the result.
+func popTokens(vm *machine, n int) ([]lexer.Token, *Error) {
+	if len(vm.stack) < n {
+		return nil, newError(ErrStackUnderflow, "need %d element(s), stack has %d", n, len(vm.stack))
 	}
-	if !aIsInt && !bIsInt {
-		result.TokenType = lexer.TypeFLOAT
-		result.Value = tokenA.Value.(float64) + tokenB.Value.(float64)
-		return
+	toks := make([]lexer.Token, n)
+	for j := 0; j < n; j++ {
+		vm.stack, toks[j] = vm.stack.Pop()
 	}
-	if aIsInt && !bIsInt {
-		result.TokenType = lexer.TypeFLOAT
-		result.Value = float64(tokenA.Value.(int64)) + tokenB.Value.(float64)
-		return
+	return toks, nil
+}
+
+// binaryOperation pops two tokens, applies op and pushes the result.
+func binaryOperation(vm *machine, op func(lexer.Token, lexer.Token) (lexer.Token, *Error)) *Error {
+	toks, err := popTokens(vm, 2)
+	if err != nil {
+		return err
 	}
+	result, err := op(toks[0], toks[1])
+	if err != nil {
+		return err
+	}
+	vm.stack = vm.stack.Push(result)
+	return nil
+}
 
-	result.TokenType = lexer.TypeFLOAT
-	result.Value = tokenA.Value.(float64) + float64(tokenB.Value.(int64))
-	return
+// labelOperand reads the marker name following the keyword at i.
+func labelOperand(vm *machine, i int) (string, *Error) {
+	if i+1 >= len(vm.script.tokens) {
+		return "", newError(ErrInvalidProgram, "missing label")
+	}
+	label, ok := vm.script.tokens[i+1].Value.(string)
+	if !ok || vm.script.tokens[i+1].TokenType != lexer.TypeSTRING {
+		return "", newError(ErrTypeMismatch, "label must be a STRING")
+	}
+	return label, nil
 }
 
-// tokenSubtraction will subtract the second token by the first and
-// return the result.
-func tokenSubtraction(tokenB lexer.Token, tokenA lexer.Token) (result lexer.Token) {
+// countOperand reads the INT following the keyword at i and checks
+// it is a valid depth into the stack.
+func countOperand(vm *machine, i int) (int, *Error) {
+	if i+1 >= len(vm.script.tokens) {
+		return 0, newError(ErrInvalidProgram, "missing count")
+	}
+	count, ok := vm.script.tokens[i+1].Value.(int64)
+	if !ok || vm.script.tokens[i+1].TokenType != lexer.TypeINT {
+		return 0, newError(ErrTypeMismatch, "count must be an INT")
+	}
+	if count < 1 || count > int64(len(vm.stack)) {
+		return 0, newError(ErrStackUnderflow, "count %d out of range, stack has %d", count, len(vm.stack))
+	}
+	return int(count), nil
+}
 
-	aIsInt := tokenA.TokenType == lexer.TypeINT
-	bIsInt := tokenB.TokenType == lexer.TypeINT
+// jumpTarget reads the jump target the parser stored in an IF or
+// FUNC token.
+func jumpTarget(vm *machine, token lexer.Token) (int, *Error) {
+	target, ok := token.Value.(int)
+	if !ok || target < 0 || target >= len(vm.script.tokens) {
+		return 0, newError(ErrInvalidProgram, "bad jump target %v", token.Value)
+	}
+	return target, nil
+}
 
-	if aIsInt && bIsInt {
-		result.TokenType = lexer.TypeINT
-		result.Value = tokenA.Value.(int64) - tokenB.Value.(int64)
+// numericOperands reads two numeric tokens, if both are INT they are
+// returned as int64, otherwise both are promoted to float64.
+func numericOperands(tokenA lexer.Token, tokenB lexer.Token) (ia, ib int64, fa, fb float64, isInt bool, err *Error) {
+	var aIsInt, bIsInt bool
+	if ia, fa, aIsInt, err = numericValue(tokenA); err != nil {
 		return
 	}
-	if !aIsInt && !bIsInt {
-		result.TokenType = lexer.TypeFLOAT
-		result.Value = tokenA.Value.(float64) - tokenB.Value.(float64)
+	if ib, fb, bIsInt, err = numericValue(tokenB); err != nil {
 		return
 	}
-	if aIsInt && !bIsInt {
-		result.TokenType = lexer.TypeFLOAT
-		result.Value = float64(tokenA.Value.(int64)) - tokenB.Value.(float64)
+	if aIsInt && bIsInt {
+		isInt = true
 		return
 	}
-
-	result.TokenType = lexer.TypeFLOAT
-	result.Value = tokenA.Value.(float64) - float64(tokenB.Value.(int64))
+	if aIsInt {
+		fa = float64(ia)
+	}
+	if bIsInt {
+		fb = float64(ib)
+	}
 	return
 }
 
-// tokenMultiply will subtract the second token by the first and
-// return the result.
-func tokenMultiply(tokenA lexer.Token, tokenB lexer.Token) (result lexer.Token) {
-
-	aIsInt := tokenA.TokenType == lexer.TypeINT
-	bIsInt := tokenB.TokenType == lexer.TypeINT
+// numericValue reads an INT or FLOAT token.
+func numericValue(token lexer.Token) (i int64, f float64, isInt bool, err *Error) {
+	var ok bool
+	switch token.TokenType {
+	case lexer.TypeINT:
+		i, ok = token.Value.(int64)
+		isInt = true
+	case lexer.TypeFLOAT:
+		f, ok = token.Value.(float64)
+	}
+	if !ok {
+		err = newError(ErrTypeMismatch, "expected a number, got %v", token)
+	}
+	return
+}
 
-	if aIsInt && bIsInt {
-		result.TokenType = lexer.TypeINT
-		result.Value = tokenA.Value.(int64) * tokenB.Value.(int64)
+// tokenAddition will add two tokens together and will return the
+// result.
+func tokenAddition(tokenA lexer.Token, tokenB lexer.Token) (result lexer.Token, err *Error) {
+	ia, ib, fa, fb, isInt, err := numericOperands(tokenA, tokenB)
+	if err != nil {
 		return
 	}
-	if !aIsInt && !bIsInt {
-		result.TokenType = lexer.TypeFLOAT
-		result.Value = tokenA.Value.(float64) * tokenB.Value.(float64)
-		return
+	if isInt {
+		return lexer.Token{TokenType: lexer.TypeINT, Value: ia + ib}, nil
 	}
-	if aIsInt && !bIsInt {
-		result.TokenType = lexer.TypeFLOAT
-		result.Value = float64(tokenA.Value.(int64)) * tokenB.Value.(float64)
+	return lexer.Token{TokenType: lexer.TypeFLOAT, Value: fa + fb}, nil
+}
+
+// tokenSubtraction will subtract the second token by the first and
+// return the result.
+func tokenSubtraction(tokenB lexer.Token, tokenA lexer.Token) (result lexer.Token, err *Error) {
+	ia, ib, fa, fb, isInt, err := numericOperands(tokenA, tokenB)
+	if err != nil {
 		return
 	}
+	if isInt {
+		return lexer.Token{TokenType: lexer.TypeINT, Value: ia - ib}, nil
+	}
+	return lexer.Token{TokenType: lexer.TypeFLOAT, Value: fa - fb}, nil
+}
 
-	result.TokenType = lexer.TypeFLOAT
-	result.Value = tokenA.Value.(float64) * float64(tokenB.Value.(int64))
-	return
+// tokenMultiply will multiply two tokens together and return the
+// result.
+func tokenMultiply(tokenA lexer.Token, tokenB lexer.Token) (result lexer.Token, err *Error) {
+	ia, ib, fa, fb, isInt, err := numericOperands(tokenA, tokenB)
+	if err != nil {
+		return
+	}
+	if isInt {
+		return lexer.Token{TokenType: lexer.TypeINT, Value: ia * ib}, nil
+	}
+	return lexer.Token{TokenType: lexer.TypeFLOAT, Value: fa * fb}, nil
 }
 
-// tokenDivide will subtract the second token by the first and
+// tokenDivide will divide the second token by the first and
 // return the result.
-func tokenDivide(tokenB lexer.Token, tokenA lexer.Token) (result lexer.Token) {
-
-	aIsInt := tokenA.TokenType == lexer.TypeINT
-	bIsInt := tokenB.TokenType == lexer.TypeINT
-
-	if aIsInt && bIsInt {
-		result.TokenType = lexer.TypeINT
-		result.Value = tokenA.Value.(int64) / tokenB.Value.(int64)
+func tokenDivide(tokenB lexer.Token, tokenA lexer.Token) (result lexer.Token, err *Error) {
+	ia, ib, fa, fb, isInt, err := numericOperands(tokenA, tokenB)
+	if err != nil {
 		return
 	}
-	if !aIsInt && !bIsInt {
-		result.TokenType = lexer.TypeFLOAT
-		result.Value = tokenA.Value.(float64) / tokenB.Value.(float64)
-		return
+	if isInt {
+		if ib == 0 {
+			return result, newError(ErrDivisionByZero, "%d / 0", ia)
+		}
+		return lexer.Token{TokenType: lexer.TypeINT, Value: ia / ib}, nil
 	}
-	if aIsInt && !bIsInt {
-		result.TokenType = lexer.TypeFLOAT
-		result.Value = float64(tokenA.Value.(int64)) / tokenB.Value.(float64)
-		return
+	if fb == 0 {
+		return result, newError(ErrDivisionByZero, "%v / 0", fa)
 	}
+	return lexer.Token{TokenType: lexer.TypeFLOAT, Value: fa / fb}, nil
+}
 
-	result.TokenType = lexer.TypeFLOAT
-	result.Value = tokenA.Value.(float64) / float64(tokenB.Value.(int64))
-	return
+// hashes maps the hash keywords to their hash function.
+var hashes = map[int]func([]byte) []byte{
+	lexer.TypeHASH: func(b []byte) []byte {
+		hash := sha256.Sum256(b)
+		return hash[:]
+	},
+	lexer.TypeSHA512: func(b []byte) []byte {
+		hash := sha512.Sum512(b)
+		return hash[:]
+	},
+	lexer.TypeSHA3: func(b []byte) []byte {
+		hash := sha3.Sum256(b)
+		return hash[:]
+	},
+	lexer.TypeHASH160: func(b []byte) []byte {
+		hash := sha256.Sum256(b)
+		return ripemd160(hash[:])
+	},
+	lexer.TypeHASH256: func(b []byte) []byte {
+		hash := sha256.Sum256(b)
+		hash = sha256.Sum256(hash[:])
+		return hash[:]
+	},
 }
 
-// tokenHash will apply sha256 to input string token and return
-// the result as a string token.
-func tokenHash(tokenA lexer.Token) (result lexer.Token) {
+// tokenHash will apply sum to input string token and return the
+// result as a hex string token. BYTES are hashed directly and the
+// result is returned as BYTES.
+func tokenHash(tokenA lexer.Token, sum func([]byte) []byte) (result lexer.Token, err *Error) {
+	if b, ok := tokenA.Value.([]byte); ok && tokenA.TokenType == lexer.TypeBYTES {
+		return lexer.Token{TokenType: lexer.TypeBYTES, Value: sum(b)}, nil
+	}
+	s, ok := tokenA.Value.(string)
+	if !ok || tokenA.TokenType != lexer.TypeSTRING {
+		return result, newError(ErrTypeMismatch, "expected a STRING or BYTES, got %v", tokenA)
+	}
 	result.TokenType = lexer.TypeSTRING
-	buf := []byte(tokenA.Value.(string))
-	hash := sha256.Sum256(buf)
-	result.Value = hex.EncodeToString(hash[:])
+	result.Value = hex.EncodeToString(sum([]byte(s)))
 	return
 }
+
+// tokenConvert will convert the token with the TOHEX, FROMHEX, TOINT
+// or TOBYTES keyword given in op.
+func tokenConvert(op int, tokenA lexer.Token) (lexer.Token, *Error) {
+	switch op {
+	case lexer.TypeTOHEX:
+		b, ok := tokenA.Value.([]byte)
+		if !ok || tokenA.TokenType != lexer.TypeBYTES {
+			return lexer.Token{}, newError(ErrTypeMismatch, "TOHEX expects BYTES, got %v", tokenA)
+		}
+		return lexer.Token{TokenType: lexer.TypeSTRING, Value: hex.EncodeToString(b)}, nil
+	case lexer.TypeFROMHEX:
+		if tokenA.TokenType != lexer.TypeSTRING {
+			return lexer.Token{}, newError(ErrTypeMismatch, "FROMHEX expects a hex STRING, got %v", tokenA)
+		}
+		b, err := byteValue(tokenA)
+		if err != nil {
+			return lexer.Token{}, err
+		}
+		return lexer.Token{TokenType: lexer.TypeBYTES, Value: b}, nil
+	case lexer.TypeTOINT:
+		// Big-endian two's complement, shorter values are sign
+		// extended
+		b, ok := tokenA.Value.([]byte)
+		if !ok || tokenA.TokenType != lexer.TypeBYTES || len(b) > 8 {
+			return lexer.Token{}, newError(ErrTypeMismatch, "TOINT expects at most 8 BYTES, got %v", tokenA)
+		}
+		var v int64
+		if len(b) > 0 && b[0]&0x80 != 0 {
+			v = -1
+		}
+		for _, c := range b {
+			v = v<<8 | int64(c)
+		}
+		return lexer.Token{TokenType: lexer.TypeINT, Value: v}, nil
+	default:
+		v, ok := tokenA.Value.(int64)
+		if !ok || tokenA.TokenType != lexer.TypeINT {
+			return lexer.Token{}, newError(ErrTypeMismatch, "TOBYTES expects an INT, got %v", tokenA)
+		}
+		b := make([]byte, 8)
+		binary.BigEndian.PutUint64(b, uint64(v))
+		return lexer.Token{TokenType: lexer.TypeBYTES, Value: b}, nil
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2018 <kassCrypto@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this
+// software and associated documentation files (the "Software"), to deal in the Software
+// without restriction, including without limitation the rights to use, copy, modify,
+// merge, publish, distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to the following
+// conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies
+// or substantial portions of the Software.
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+// INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A
+// PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT
+// HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF
+// CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+// OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package executor
+
+import (
+	"fmt"
+	"splashcode/lexer"
+	"splashcode/parser"
+	"testing"
+)
+
+func intToken(v int64) lexer.Token {
+	return lexer.Token{TokenType: lexer.TypeINT, Value: v}
+}
+
+// PICK and ROLL read their count from the next token. They used to
+// push the count as well, and ROLL removed the element above the one
+// it moved.
+func TestPickRoll(t *testing.T) {
+	tests := []struct {
+		op       int
+		old, new string
+	}{
+		{lexer.TypePICK, "[1 2 3 1 3]", "[1 2 3 1]"},
+		{lexer.TypeROLL, "[1 3 1 3]", "[2 3 1]"},
+	}
+	for _, test := range tests {
+		prog := parser.Program{Tokens: []lexer.Token{
+			intToken(1), intToken(2), intToken(3), {TokenType: test.op}, intToken(3),
+		}}
+		stack, last, err := Run(&prog, lexer.Token{}, false)
+		if err != nil {
+			t.Fatalf("%s: %v", lexer.TokenTypeToString(test.op), err)
+		}
+		var values []interface{}
+		for _, token := range stack.Push(last) {
+			values = append(values, token.Value)
+		}
+		if got := fmt.Sprint(values); got != test.new {
+			t.Errorf("%s: stack is %s, want %s (was %s)", lexer.TokenTypeToString(test.op), got, test.new, test.old)
+		}
+	}
+}
+
+// Values given by the caller are checked before the program runs,
+// comparing two []int values would otherwise panic in IF.
+func TestBadInput(t *testing.T) {
+	prog, err := parser.Parse([]lexer.Token{
+		{TokenType: lexer.TypeINPUT}, {TokenType: lexer.TypeINPUT}, {TokenType: lexer.TypeIF}, {TokenType: lexer.TypeENDIF},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = Run(&prog, lexer.Token{TokenType: lexer.TypeINT, Value: []int{1}}, false)
+	if e, ok := err.(*Error); !ok || e.Kind != ErrTypeMismatch {
+		t.Errorf("got %v, want a type mismatch", err)
+	}
+}
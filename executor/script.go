@@ -0,0 +1,108 @@
+// Copyright 2018 <kassCrypto@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this
+// software and associated documentation files (the "Software"), to deal in the Software
+// without restriction, including without limitation the rights to use, copy, modify,
+// merge, publish, distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to the following
+// conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies
+// or substantial portions of the Software.
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+// INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A
+// PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT
+// HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF
+// CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+// OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package executor
+
+import (
+	"splashcode/lexer"
+	"splashcode/parser"
+)
+
+// Script is a verified program ready to be run. A Script is never
+// changed once compiled, so it may be run any number of times and
+// from many goroutines at once.
+type Script struct {
+	tokens  []lexer.Token
+	markers map[string]int
+}
+
+// Compile will verify the program and copy it into a Script, later
+// changes to prog don't affect the Script. Policies are enforced
+// when the script is run, see Config.Policy.
+func Compile(prog *parser.Program) (*Script, error) {
+	if err := parser.Verify(prog, parser.Policy{}); err != nil {
+		return nil, verifyError(prog, err)
+	}
+	script := &Script{
+		tokens:  make([]lexer.Token, len(prog.Tokens)),
+		markers: make(map[string]int, len(prog.Markers)),
+	}
+	for i, token := range prog.Tokens {
+		if b, ok := token.Value.([]byte); ok {
+			token.Value = append([]byte{}, b...)
+		}
+		script.tokens[i] = token
+	}
+	for label, index := range prog.Markers {
+		script.markers[label] = index
+	}
+	return script, nil
+}
+
+// compileWithPolicy compiles the program and checks the policy
+// allows it.
+func compileWithPolicy(prog *parser.Program, policy parser.Policy) (*Script, error) {
+	script, err := Compile(prog)
+	if err != nil {
+		return nil, err
+	}
+	if err := policy.Check(prog); err != nil {
+		return nil, verifyError(prog, err)
+	}
+	return script, nil
+}
+
+// machine is the state of a single run of a Script.
+type machine struct {
+	script  *Script
+	stack   parser.Stack
+	marks   map[string]int // Markers added or moved by MARK in this run
+	gasUsed uint64
+}
+
+// newMachine creates the state to run script on a copy of stack.
+func newMachine(script *Script, stack parser.Stack) *machine {
+	return &machine{script: script, stack: append(make(parser.Stack, 0, len(stack)), stack...)}
+}
+
+// result returns the outcome of the run, the last token is popped
+// from the stack unless the run failed.
+func (vm *machine) result(err error) Result {
+	result := Result{Stack: vm.stack, GasUsed: vm.gasUsed}
+	if err == nil && len(vm.stack) > 0 {
+		result.Stack, result.Last = vm.stack.Pop()
+	}
+	return result
+}
+
+// marker returns the index a GOTO or CALL to label jumps to.
+func (vm *machine) marker(label string) (int, bool) {
+	if index, ok := vm.marks[label]; ok {
+		return index, true
+	}
+	index, ok := vm.script.markers[label]
+	return index, ok
+}
+
+// mark will add or update a marker for the rest of the run.
+func (vm *machine) mark(label string, index int) {
+	if vm.marks == nil {
+		vm.marks = make(map[string]int)
+	}
+	vm.marks[label] = index
+}
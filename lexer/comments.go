@@ -0,0 +1,67 @@
+// Copyright 2018 <kassCrypto@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this
+// software and associated documentation files (the "Software"), to deal in the Software
+// without restriction, including without limitation the rights to use, copy, modify,
+// merge, publish, distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to the following
+// conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies
+// or substantial portions of the Software.
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+// INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A
+// PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT
+// HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF
+// CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+// OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package lexer
+
+import "strings"
+
+// stripComments replaces "// line" and "/* block */" comments in data
+// with spaces, so the positions of the remaining tokens don't change.
+// Comment characters inside strings are kept.
+func stripComments(file string, data string) (string, error) {
+	buf := []byte(data)
+	inString := false
+	line, lineStart := 1, 0
+
+	for i := 0; i < len(buf); i++ {
+		switch {
+		case buf[i] == '\n':
+			// strings end with the line
+			line, lineStart = line+1, i+1
+			inString = false
+		case inString && buf[i] == '\\':
+			// skip the escaped character
+			if i+1 < len(buf) && buf[i+1] != '\n' {
+				i++
+			}
+		case buf[i] == '"':
+			inString = !inString
+		case inString:
+		case strings.HasPrefix(data[i:], "//"):
+			for ; i < len(buf) && buf[i] != '\n'; i++ {
+				buf[i] = ' '
+			}
+			i--
+		case strings.HasPrefix(data[i:], "/*"):
+			end := strings.Index(data[i+2:], "*/")
+			if end == -1 {
+				return "", &Error{Position{file, line, i - lineStart + 1}, "Unterminated block comment"}
+			}
+			for end += i + 4; i < end; i++ {
+				if buf[i] == '\n' {
+					line, lineStart = line+1, i+1
+				} else {
+					buf[i] = ' '
+				}
+			}
+			i--
+		}
+	}
+
+	return string(buf), nil
+}
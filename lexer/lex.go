@@ -19,6 +19,7 @@
 package lexer
 
 import (
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"strconv"
@@ -31,88 +32,170 @@ const numbers = "-0123456789"
 type Token struct {
 	TokenType int
 	Value     interface{}
+	Pos       Position // Where the token was found in the source
+}
+
+// Position - the file, line and column of a token in the source,
+// lines and columns start at 1. The zero Position is unknown.
+type Position struct {
+	File   string
+	Line   int
+	Column int
+}
+
+func (pos Position) String() string {
+	if pos.Line == 0 {
+		return pos.File
+	}
+	s := fmt.Sprintf("%d:%d", pos.Line, pos.Column)
+	if pos.File != "" {
+		s = pos.File + ":" + s
+	}
+	return s
+}
+
+// Error - returned when the source cannot be tokenized
+type Error struct {
+	Pos Position
+	Msg string
+}
+
+func (err *Error) Error() string {
+	return err.Pos.String() + ": " + err.Msg
 }
 
 // Tokenize - Converts some utf-8 *.sc string to splashcode tokens
-func Tokenize(data string, debug bool) []Token {
+func Tokenize(data string, debug bool) ([]Token, error) {
+	return TokenizeFile("", data, debug)
+}
+
+// TokenizeFile - Converts the utf-8 *.sc string read from file to
+// splashcode tokens, each token records its position in file.
+func TokenizeFile(file string, data string, debug bool) ([]Token, error) {
 
 	if debug {
 		fmt.Println("DEBUG:: Tokenizing...")
 	}
 
-	//Replace new lines
-	data = strings.Replace(data, "\n", ",", -1)
-
-	//Replace escaped Commands
-	data = strings.Replace(data, "\\,", "{COMMA}", -1)
-
-	//Seperate targets
-	buf := strings.Split(data, ",")
+	//Remove comments
+	data, err := stripComments(file, data)
+	if err != nil {
+		return nil, err
+	}
 
 	//Make empty token array
-	tokens := make([]Token, len(buf))
+	tokens := make([]Token, 0)
 
-	// Loop through all the []string and convert each
-	// token to string
-	for i := 0; i < len(buf); i++ {
+	// Loop through every line, and convert each comma
+	// seperated target to a token
+	for line, text := range strings.Split(data, "\n") {
+		targets, err := splitTargets(text)
+		if err != nil {
+			return nil, positionError(Position{file, line + 1, 1}, err)
+		}
 
-		//Convert string to token
-		target := strings.TrimSpace(buf[i])
-		token := StringToToken(target)
+		for _, target := range targets {
+			pos := Position{file, line + 1, target.column}
 
-		if token.Value == nil && token.TokenType == 0 {
-			continue
-		}
+			//Convert string to token
+			token, err := ParseToken(target.text)
+			if err != nil {
+				return nil, positionError(pos, err)
+			}
 
-		//Add token to array
-		tokens[i] = token
+			if token.Value == nil && token.TokenType == 0 {
+				continue
+			}
 
-		//print token if debug was enabled
-		if debug {
-			fmt.Println("   Registering Token::", token)
-		}
+			//Add token to array
+			token.Pos = pos
+			tokens = append(tokens, token)
 
+			//print token if debug was enabled
+			if debug {
+				fmt.Println("   Registering Token::", token, "at", pos)
+			}
+		}
 	}
 
-	return tokens
+	return tokens, nil
+}
+
+// positionError converts err to an Error at pos, the offset of a
+// syntaxError is added to the column.
+func positionError(pos Position, err error) *Error {
+	if serr, ok := err.(*syntaxError); ok {
+		pos.Column += serr.offset
+	}
+	return &Error{pos, err.Error()}
 }
 
 // StringToToken convert a string to a token
 // This will panic in the event of an unknown
 // token.
 func StringToToken(target string) (token Token) {
+	token, err := ParseToken(target)
+	if err != nil {
+		panic(err)
+	}
+	return
+}
+
+// ParseToken convert a string to a token like
+// StringToToken, but returns an error in the
+// event of an unknown token.
+func ParseToken(target string) (token Token, err error) {
+	var isString, isBytes, isNumber bool
 	if target == "" {
 		return
-	} else if token.tokenizeString(target) {
-	} else if token.tokenizeNumber(target) {
+	} else if isString, err = token.tokenizeString(target); isString {
+	} else if isBytes, err = token.tokenizeBytes(target); isBytes {
+	} else if isNumber, err = token.tokenizeNumber(target); isNumber {
 	} else if token.tokenizeBoolean(target) {
 	} else if token.tokenizeKeywords(target) {
 	} else {
-		panic(errors.New("Unknown syntax: `" + target + "`"))
+		err = errors.New("Unknown syntax: `" + target + "`")
 	}
 	return
 }
 
-func (token *Token) tokenizeString(target string) bool {
+func (token *Token) tokenizeString(target string) (bool, error) {
 	if string(target[0]) == "\"" {
-		target = strings.Replace(target, "\"", "", 2)
-		target = strings.Replace(target, "{COMMA}", ",", -1)
+		value, end, err := scanString(target, 0)
+		if err != nil {
+			return true, err
+		}
+		if end != len(target) {
+			return true, &syntaxError{end, "Unexpected `" + target[end:] + "` after string"}
+		}
 		token.TokenType = TypeSTRING
-		token.Value = target
-		return true
+		token.Value = value
+		return true, nil
 	}
-	return false
+	return false, nil
 }
-func (token *Token) tokenizeNumber(target string) bool {
+func (token *Token) tokenizeBytes(target string) (bool, error) {
+	if strings.HasPrefix(target, "0x") {
+		b, err := hex.DecodeString(target[2:])
+		if err != nil {
+			return true, fmt.Errorf("Invalid BYTES: `%s`", target)
+		}
+		token.TokenType = TypeBYTES
+		token.Value = b
+		return true, nil
+	}
+	return false, nil
+}
+func (token *Token) tokenizeNumber(target string) (bool, error) {
 	if strings.Contains(numbers, string(target[0])) {
 
 		//check if number is float:
 		if strings.ContainsAny(target, "f") || strings.ContainsAny(target, ".") {
 			token.TokenType = TypeFLOAT
 			// convert float to bytes:
-			f, err := strconv.ParseFloat(target, 64)
+			f, err := strconv.ParseFloat(strings.TrimSuffix(target, "f"), 64)
 			if err != nil {
-				panic(err)
+				return true, fmt.Errorf("Invalid FLOAT: `%s`", target)
 			}
 			token.Value = f
 		} else {
@@ -121,14 +204,14 @@ func (token *Token) tokenizeNumber(target string) bool {
 			// convert int to bytes:
 			i, err := strconv.ParseInt(target, 10, 64)
 			if err != nil {
-				panic(err)
+				return true, fmt.Errorf("Invalid INT: `%s`", target)
 			}
 			token.Value = i
 		}
 
-		return true
+		return true, nil
 	}
-	return false
+	return false, nil
 }
 func (token *Token) tokenizeBoolean(target string) bool {
 	if target == "TRUE" || target == "FALSE" {
@@ -197,10 +280,113 @@ func (token *Token) tokenizeKeywords(target string) bool {
 	case "PRINTLN":
 		token.TokenType = TypePRINTLN
 		break
-	case "":
-		return false
+	case "CALL":
+		token.TokenType = TypeCALL
+		break
+	case "RETURN":
+		token.TokenType = TypeRETURN
+		break
+	case "ELSE":
+		token.TokenType = TypeELSE
+		break
+	case "LT":
+		token.TokenType = TypeLT
+		break
+	case "GT":
+		token.TokenType = TypeGT
+		break
+	case "LTE":
+		token.TokenType = TypeLTE
+		break
+	case "GTE":
+		token.TokenType = TypeGTE
+		break
+	case "EQ":
+		token.TokenType = TypeEQ
+		break
+	case "NEQ":
+		token.TokenType = TypeNEQ
+		break
+	case "AND":
+		token.TokenType = TypeAND
+		break
+	case "OR":
+		token.TokenType = TypeOR
+		break
+	case "NOT":
+		token.TokenType = TypeNOT
+		break
+	case "IFTRUE":
+		token.TokenType = TypeIFTRUE
+		break
+	case "AMOUNT":
+		token.TokenType = TypeAMOUNT
+		break
+	case "SENDER":
+		token.TokenType = TypeSENDER
+		break
+	case "RECIPIENT":
+		token.TokenType = TypeRECIPIENT
+		break
+	case "TIMESTAMP":
+		token.TokenType = TypeTIMESTAMP
+		break
+	case "NONCE":
+		token.TokenType = TypeNONCE
+		break
+	case "HEIGHT":
+		token.TokenType = TypeHEIGHT
+		break
+	case "CHECKSIG":
+		token.TokenType = TypeCHECKSIG
+		break
+	case "CHECKSIGVERIFY":
+		token.TokenType = TypeCHECKSIGVERIFY
+		break
+	case "CHECKMULTISIG":
+		token.TokenType = TypeCHECKMULTISIG
+		break
+	case "TOHEX":
+		token.TokenType = TypeTOHEX
+		break
+	case "FROMHEX":
+		token.TokenType = TypeFROMHEX
+		break
+	case "TOINT":
+		token.TokenType = TypeTOINT
+		break
+	case "TOBYTES":
+		token.TokenType = TypeTOBYTES
+		break
+	case "SHA512":
+		token.TokenType = TypeSHA512
+		break
+	case "SHA3":
+		token.TokenType = TypeSHA3
+		break
+	case "HASH160":
+		token.TokenType = TypeHASH160
+		break
+	case "HASH256":
+		token.TokenType = TypeHASH256
+		break
+	case "CHECKLOCKTIME":
+		token.TokenType = TypeCHECKLOCKTIME
+		break
+	case "CHECKSEQUENCE":
+		token.TokenType = TypeCHECKSEQUENCE
+		break
+	case "VERIFY":
+		token.TokenType = TypeVERIFY
+		break
+	case "EQUALVERIFY":
+		token.TokenType = TypeEQUALVERIFY
+		break
+	case "RETURN_FAIL":
+		token.TokenType = TypeRETURNFAIL
+		break
 	default:
-		panic(errors.New("Unknown keywork:" + target))
+		return false
 	}
 	return true
 }
@@ -0,0 +1,133 @@
+// Copyright 2018 <kassCrypto@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this
+// software and associated documentation files (the "Software"), to deal in the Software
+// without restriction, including without limitation the rights to use, copy, modify,
+// merge, publish, distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to the following
+// conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies
+// or substantial portions of the Software.
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+// INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A
+// PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT
+// HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF
+// CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+// OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package lexer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// target is a comma seperated field of a line and the column it
+// starts at.
+type target struct {
+	text   string
+	column int
+}
+
+// syntaxError - an error found at a byte offset of the scanned text
+type syntaxError struct {
+	offset int
+	msg    string
+}
+
+func (err *syntaxError) Error() string {
+	return err.msg
+}
+
+// splitTargets splits a line on every comma outside of a string,
+// string literals are kept whole including their quotes.
+func splitTargets(line string) (targets []target, err error) {
+	for i := 0; ; i++ {
+		// skip leading whitespace
+		for i < len(line) && strings.ContainsRune(" \t\r", rune(line[i])) {
+			i++
+		}
+		start := i
+
+		if i < len(line) && line[i] == '"' {
+			if _, i, err = scanString(line, i); err != nil {
+				return nil, err
+			}
+		}
+		for i < len(line) && line[i] != ',' {
+			i++
+		}
+
+		targets = append(targets, target{strings.TrimSpace(line[start:i]), start + 1})
+		if i >= len(line) {
+			return
+		}
+	}
+}
+
+// scanString reads the string literal whose opening quote is at
+// s[start], it returns the unescaped value and the index after the
+// closing quote.
+func scanString(s string, start int) (string, int, error) {
+	var buf []byte
+	for i := start + 1; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			return string(buf), i + 1, nil
+		case '\\':
+			value, n, err := scanEscape(s, i)
+			if err != nil {
+				return "", 0, err
+			}
+			buf = append(buf, value...)
+			i += n - 1
+		default:
+			buf = append(buf, s[i])
+		}
+	}
+	return "", 0, &syntaxError{start, "Unterminated string"}
+}
+
+// scanEscape reads the escape sequence starting with the backslash
+// at s[i], it returns the bytes it stands for and its length.
+//
+//	\"  \\  \,  \n  \t  \xNN  \u{N...}
+func scanEscape(s string, i int) ([]byte, int, error) {
+	if i+1 >= len(s) {
+		return nil, 0, &syntaxError{i, "Unterminated escape sequence"}
+	}
+	switch s[i+1] {
+	case '"', '\\', ',':
+		return []byte{s[i+1]}, 2, nil
+	case 'n':
+		return []byte{'\n'}, 2, nil
+	case 't':
+		return []byte{'\t'}, 2, nil
+	case 'x':
+		if i+4 > len(s) {
+			return nil, 0, &syntaxError{i, "Invalid escape `" + s[i:] + "`, expected \\xNN"}
+		}
+		b, err := strconv.ParseUint(s[i+2:i+4], 16, 8)
+		if err != nil {
+			return nil, 0, &syntaxError{i, "Invalid escape `" + s[i:i+4] + "`, expected \\xNN"}
+		}
+		return []byte{byte(b)}, 4, nil
+	case 'u':
+		end := strings.IndexByte(s[i:], '}')
+		if i+2 >= len(s) || s[i+2] != '{' || end == -1 {
+			return nil, 0, &syntaxError{i, "Invalid escape, expected \\u{N...}"}
+		}
+		digits := s[i+3 : i+end]
+		r, err := strconv.ParseUint(digits, 16, 32)
+		if err != nil || len(digits) > 6 || !utf8.ValidRune(rune(r)) {
+			return nil, 0, &syntaxError{i, "Invalid unicode code point `" + s[i:i+end+1] + "`"}
+		}
+		buf := make([]byte, utf8.UTFMax)
+		return buf[:utf8.EncodeRune(buf, rune(r))], end + 1, nil
+	default:
+		return nil, 0, &syntaxError{i, fmt.Sprintf("Invalid escape `\\%c`", s[i+1])}
+	}
+}
@@ -20,30 +20,69 @@ package lexer
 
 import "fmt"
 
+// Token types double as the opcodes listed in the README and used
+// in compiled bytecode, 0 is not a valid token type.
 const (
-	TypeINT     = iota // An integer
-	TypeFLOAT   = iota // A float
-	TypeSTRING  = iota // A string
-	TypeBOOLEAN = iota // A Boolean
-	TypeGOTO    = iota // Goto a Marker
-	TypeMARK    = iota // Marks a position for goto Marker "name"
-	TypeIF      = iota // If compares the last 2 elementsin stack, if not equal skip to next end if
-	TypeENDIF   = iota // Marks end of IF
-	TypeFUNC    = iota // Marks a start of a function
-	TypeENDFUNC = iota // Marks the end of a function
-	TypeDUP     = iota // Duplicates the last element and adds to stack
-	TypeDROP    = iota // Deletes last element from stack
-	TypePICK    = iota // Duplicates a previous element from stack e.g PICK 5
-	TypeROLL    = iota // moves a previous element from stack and places it at the top e.g ROLL 5
-	TypeFIN     = iota // Quits program, often displaying the last value in stack
-	TypeADD     = iota // Will add the last two elements in stack and add result to stack
-	TypeSUB     = iota // Will subtract the last two elements and add result to stack
-	TypeMUL     = iota // Will Multiply the last two elements and add result to stack
-	TypeDIV     = iota // Will Divide the last two elements and add result to stack
-	TypeHASH    = iota // This will sha256 hash the last element into the stack
-	TypeINPUT   = iota // This will read a token from input into stack
-	TypePRINT   = iota // This will print the last element in stack
-	TypePRINTLN = iota // This will print out a line
+	_                  = iota
+	TypeINT            = iota // An integer
+	TypeFLOAT          = iota // A float
+	TypeSTRING         = iota // A string
+	TypeBOOLEAN        = iota // A Boolean
+	TypeGOTO           = iota // Goto a Marker
+	TypeMARK           = iota // Marks a position for goto Marker "name"
+	TypeIF             = iota // If compares the last 2 elementsin stack, if not equal skip to next end if
+	TypeENDIF          = iota // Marks end of IF
+	TypeFUNC           = iota // Marks a start of a function
+	TypeENDFUNC        = iota // Marks the end of a function
+	TypeDUP            = iota // Duplicates the last element and adds to stack
+	TypeDROP           = iota // Deletes last element from stack
+	TypePICK           = iota // Duplicates a previous element from stack e.g PICK 5
+	TypeROLL           = iota // moves a previous element from stack and places it at the top e.g ROLL 5
+	TypeFIN            = iota // Quits program, often displaying the last value in stack
+	TypeADD            = iota // Will add the last two elements in stack and add result to stack
+	TypeSUB            = iota // Will subtract the last two elements and add result to stack
+	TypeMUL            = iota // Will Multiply the last two elements and add result to stack
+	TypeDIV            = iota // Will Divide the last two elements and add result to stack
+	TypeHASH           = iota // This will sha256 hash the last element into the stack
+	TypeINPUT          = iota // This will read a token from input into stack
+	TypePRINT          = iota // This will print the last element in stack
+	TypePRINTLN        = iota // This will print out a line
+	TypeCALL           = iota // Calls a function, execution returns to the caller on RETURN
+	TypeRETURN         = iota // Returns from a function to the token after its CALL
+	TypeELSE           = iota // Marks the start of the branch taken when an IF fails
+	TypeLT             = iota // Pushes TRUE if the second last element is less than the last
+	TypeGT             = iota // Pushes TRUE if the second last element is greater than the last
+	TypeLTE            = iota // Pushes TRUE if the second last element is less than or equal to the last
+	TypeGTE            = iota // Pushes TRUE if the second last element is greater than or equal to the last
+	TypeEQ             = iota // Pushes TRUE if the last two elements are equal
+	TypeNEQ            = iota // Pushes TRUE if the last two elements are not equal
+	TypeAND            = iota // Pushes TRUE if the last two booleans are both TRUE
+	TypeOR             = iota // Pushes TRUE if either of the last two booleans are TRUE
+	TypeNOT            = iota // Inverts the last boolean
+	TypeIFTRUE         = iota // Pops a boolean, if FALSE skip to next ELSE or ENDIF
+	TypeAMOUNT         = iota // Pushes the amount of the transaction
+	TypeSENDER         = iota // Pushes the address of the sender
+	TypeRECIPIENT      = iota // Pushes the address of the recipient
+	TypeTIMESTAMP      = iota // Pushes the unix time of the block
+	TypeNONCE          = iota // Pushes the nonce of the transaction
+	TypeHEIGHT         = iota // Pushes the height of the block
+	TypeCHECKSIG       = iota // Pops a public key and a signature, pushes TRUE if it signed the transaction
+	TypeCHECKSIGVERIFY = iota // Like CHECKSIG, but fails the script instead of pushing FALSE
+	TypeCHECKMULTISIG  = iota // Pops N keys and M signatures, pushes TRUE if all M signed the transaction
+	TypeBYTES          = iota // A byte string
+	TypeTOHEX          = iota // Converts BYTES to a hex STRING
+	TypeFROMHEX        = iota // Converts a hex STRING to BYTES
+	TypeTOINT          = iota // Converts big-endian BYTES to an INT
+	TypeTOBYTES        = iota // Converts an INT to 8 big-endian BYTES
+	TypeSHA512         = iota // This will sha512 hash the last element into the stack
+	TypeSHA3           = iota // This will sha3-256 hash the last element into the stack
+	TypeHASH160        = iota // This will ripemd160 hash the sha256 hash of the last element into the stack
+	TypeHASH256        = iota // This will sha256 hash the last element twice into the stack
+	TypeCHECKLOCKTIME  = iota // Fails the script if the block height or time is before the last element
+	TypeCHECKSEQUENCE  = iota // Fails the script if the spent output is younger than the last element in blocks
+	TypeVERIFY         = iota // Pops an element, fails the script if it is not truthy
+	TypeEQUALVERIFY    = iota // Pops two elements, fails the script if they are not equal
+	TypeRETURNFAIL     = iota // Fails the script
 )
 
 // TokenTypeToString convert an TokenType int to a string
@@ -95,17 +134,101 @@ func TokenTypeToString(tokenType int) string {
 		return "PRINT"
 	case TypePRINTLN:
 		return "PRINTLN"
+	case TypeCALL:
+		return "CALL"
+	case TypeRETURN:
+		return "RETURN"
+	case TypeELSE:
+		return "ELSE"
+	case TypeLT:
+		return "LT"
+	case TypeGT:
+		return "GT"
+	case TypeLTE:
+		return "LTE"
+	case TypeGTE:
+		return "GTE"
+	case TypeEQ:
+		return "EQ"
+	case TypeNEQ:
+		return "NEQ"
+	case TypeAND:
+		return "AND"
+	case TypeOR:
+		return "OR"
+	case TypeNOT:
+		return "NOT"
+	case TypeIFTRUE:
+		return "IFTRUE"
+	case TypeAMOUNT:
+		return "AMOUNT"
+	case TypeSENDER:
+		return "SENDER"
+	case TypeRECIPIENT:
+		return "RECIPIENT"
+	case TypeTIMESTAMP:
+		return "TIMESTAMP"
+	case TypeNONCE:
+		return "NONCE"
+	case TypeHEIGHT:
+		return "HEIGHT"
+	case TypeCHECKSIG:
+		return "CHECKSIG"
+	case TypeCHECKSIGVERIFY:
+		return "CHECKSIGVERIFY"
+	case TypeCHECKMULTISIG:
+		return "CHECKMULTISIG"
+	case TypeBYTES:
+		return "BYTES"
+	case TypeTOHEX:
+		return "TOHEX"
+	case TypeFROMHEX:
+		return "FROMHEX"
+	case TypeTOINT:
+		return "TOINT"
+	case TypeTOBYTES:
+		return "TOBYTES"
+	case TypeSHA512:
+		return "SHA512"
+	case TypeSHA3:
+		return "SHA3"
+	case TypeHASH160:
+		return "HASH160"
+	case TypeHASH256:
+		return "HASH256"
+	case TypeCHECKLOCKTIME:
+		return "CHECKLOCKTIME"
+	case TypeCHECKSEQUENCE:
+		return "CHECKSEQUENCE"
+	case TypeVERIFY:
+		return "VERIFY"
+	case TypeEQUALVERIFY:
+		return "EQUALVERIFY"
+	case TypeRETURNFAIL:
+		return "RETURN_FAIL"
 	default:
 		return "UNKNOWN"
 	}
+}
 
-	return "UNKNOWN"
+// IsTokenType reports whether tokenType is a known token type.
+func IsTokenType(tokenType int) bool {
+	return TokenTypeToString(tokenType) != "UNKNOWN"
 }
 
 func (token Token) String() string {
 	s := "{"
 	s += TokenTypeToString(token.TokenType) + ": "
-	s += fmt.Sprintf("%v", token.Value)
+	s += token.ValueString()
 	s += "}"
 	return s
 }
+
+// ValueString formats the value of the token, BYTES are written
+// like their 0x literal.
+func (token Token) ValueString() string {
+	if b, ok := token.Value.([]byte); ok {
+		return fmt.Sprintf("0x%x", b)
+	}
+	return fmt.Sprintf("%v", token.Value)
+}
@@ -0,0 +1,13 @@
+FUNC, "Square"
+    DUP, MUL
+    RETURN
+ENDFUNC
+FUNC, "PrintSquare"
+    CALL, "Square"
+    PRINT, DROP
+    " ", PRINT, DROP
+ENDFUNC
+3, CALL, "PrintSquare"
+4, CALL, "PrintSquare"
+5, CALL, "PrintSquare"
+"", PRINTLN
@@ -19,13 +19,12 @@
 package main
 
 import (
-	"bytes"
-	"encoding/gob"
-	"encoding/hex"
 	"flag"
 	"fmt"
 	"io/ioutil"
+	"os"
 	"path/filepath"
+	"splashcode/bytecode"
 	"splashcode/executor"
 	"splashcode/lexer"
 	"splashcode/parser"
@@ -40,34 +39,66 @@ func main() {
 	debug := flag.Bool("debug", false, "print additional debuging messages")
 	input := flag.String("input", "-1", "set input for program,  the input will be parsed into a Token")
 	compile := flag.String("compile", "", "compile to a given a filepath")
+	disasm := flag.Bool("disasm", false, "print the bytecode listing of the program instead of running it")
+	transactional := flag.Bool("transactional", false, "disable loops and functions")
+	gas := flag.Uint64("gas", 0, "gas budget for the run, 0 means unlimited")
 
 	// Parse Flags
 	flag.Parse()
 
+	var policy parser.Policy
+	if *transactional {
+		policy = parser.Transactional
+	}
+
 	//Read file and Tokenize
 	var prog parser.Program
 	buf, err := ioutil.ReadFile(*filename)
+	if err != nil {
+		panic(err)
+	}
 
-	// If file is of type '.scb' splash code bytes then unmarshal
+	// If file is of type '.scb' splash code bytes then decode
 	// Otherwise assume file is of type '.sc' then tokenize and parse
 	if filepath.Ext(*filename) == ".scb" {
 		prog = loadProgFrom(buf)
-	} else {
-		if err != nil {
-			panic(err)
+
+		// The listing is printed even for a program that fails to
+		// verify, that's what it is for
+		if !*disasm {
+			if err = parser.Verify(&prog, policy); err != nil {
+				panic(err)
+			}
 		}
+	} else {
 		data := string(buf)
 
 		//Tokenize the data
-		tokens := lexer.Tokenize(data, *debug)
+		tokens, err := lexer.TokenizeFile(*filename, data, *debug)
+		if err != nil {
+			panic(err)
+		}
 
 		//Parse the tokens into a program
-		prog = parser.Parse(tokens)
+		prog, err = parser.ParseWithPolicy(tokens, policy)
+		if err != nil {
+			panic(err)
+		}
 	}
 
-	//Run or Compile
+	//Run, Compile or Disassemble
 	started := time.Now()
-	if *compile != "" {
+	if *disasm {
+		if filepath.Ext(*filename) != ".scb" {
+			if buf, err = bytecode.Encode(&prog); err != nil {
+				panic(err)
+			}
+		}
+		if err = bytecode.Disassemble(os.Stdout, buf); err != nil {
+			panic(err)
+		}
+		return
+	} else if *compile != "" {
 		if *debug {
 			fmt.Println("\nCompiling to", *compile, "...\n ")
 		}
@@ -76,7 +107,16 @@ func main() {
 		if *debug {
 			fmt.Println("\nRunning file", *filename, "...\n ")
 		}
-		executor.Run(&prog, lexer.StringToToken(*input), *stackTrace)
+		config := executor.Config{Gas: *gas, StackTrace: *stackTrace, Policy: policy}
+		result, err := executor.Execute(&prog, lexer.StringToToken(*input), config)
+		if executor.IsScriptFailure(err) {
+			fmt.Println("\nFailed:", err)
+		} else if err != nil {
+			fmt.Println("\nError:", err)
+		}
+		if *debug {
+			fmt.Println("\nGas used:", result.GasUsed)
+		}
 	}
 
 	duration := time.Since(started)
@@ -87,17 +127,11 @@ func main() {
 func saveProgTo(prog parser.Program, filePath string) {
 
 	//Encode prog
-	var data bytes.Buffer
-	enc := gob.NewEncoder(&data)
-	err := enc.Encode(prog)
+	buf, err := bytecode.Encode(&prog)
 	if err != nil {
 		panic(err)
 	}
 
-	//Hex encode
-	buf := make([]byte, hex.EncodedLen(len(data.Bytes())))
-	hex.Encode(buf, data.Bytes())
-
 	//Write to file
 	err = ioutil.WriteFile(filePath, buf, 0644)
 	if err != nil {
@@ -106,15 +140,7 @@ func saveProgTo(prog parser.Program, filePath string) {
 }
 
 func loadProgFrom(data []byte) (prog parser.Program) {
-
-	//Hex decode
-	buf := make([]byte, hex.DecodedLen(len(data)))
-	hex.Decode(buf, data)
-
-	var dataBuf bytes.Buffer
-	dataBuf.Write(buf)
-	dec := gob.NewDecoder(&dataBuf)
-	err := dec.Decode(&prog)
+	prog, err := bytecode.Decode(data)
 	if err != nil {
 		panic(err)
 	}
@@ -0,0 +1,56 @@
+// Copyright 2018 <kassCrypto@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this
+// software and associated documentation files (the "Software"), to deal in the Software
+// without restriction, including without limitation the rights to use, copy, modify,
+// merge, publish, distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to the following
+// conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies
+// or substantial portions of the Software.
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+// INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A
+// PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT
+// HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF
+// CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+// OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package parser
+
+import (
+	"fmt"
+	"splashcode/lexer"
+)
+
+// Error is returned when a program is rejected by the parser.
+type Error struct {
+	Index int            // Index of the offending token
+	Pos   lexer.Position // Position of the offending token, if known
+	Msg   string
+}
+
+func (err *Error) Error() string {
+	if err.Pos.Line > 0 {
+		return fmt.Sprintf("%v: %s", err.Pos, err.Msg)
+	}
+	return fmt.Sprintf("token %d: %s", err.Index, err.Msg)
+}
+
+// errorAt creates an Error for the token at index.
+func (prog *Program) errorAt(index int, format string, args ...interface{}) *Error {
+	return &Error{
+		Index: index,
+		Pos:   prog.Tokens[index].Pos,
+		Msg:   fmt.Sprintf(format, args...),
+	}
+}
+
+// where describes the location of the token at index, its source
+// position if known and otherwise its index.
+func (prog *Program) where(index int) string {
+	if pos := prog.Tokens[index].Pos; pos.Line > 0 {
+		return pos.String()
+	}
+	return fmt.Sprintf("token %d", index)
+}
@@ -18,14 +18,10 @@
 
 package parser
 
-import (
-	"fmt"
-	"splashcode/lexer"
-)
+import "splashcode/lexer"
 
 type Program struct {
 	Markers map[string]int
-	Stack   Stack
 	Tokens  []lexer.Token
 }
 
@@ -67,7 +63,7 @@ func (stack Stack) String() string {
 		s += "{"
 		s += lexer.TokenTypeToString(stack[i].TokenType)
 		s += ":"
-		s += fmt.Sprintf("%v", stack[i].Value)
+		s += stack[i].ValueString()
 		s += "}, "
 	}
 	s += "]"
@@ -75,43 +71,126 @@ func (stack Stack) String() string {
 }
 
 // Parse will take some splashgo tokens convert them to
-// a *Program object which can be executed.
-func Parse(tokens []lexer.Token) (prog Program) {
-	prog.Markers = make(map[string]int)
+// a *Program object which can be executed. An *Error is returned
+// if a label is missing or the blocks are not balanced.
+func Parse(tokens []lexer.Token) (prog Program, err error) {
 	prog.Tokens = tokens
-	prog.Stack = make(Stack, 0)
-	prog.Stack.Push(lexer.Token{0, 0})
+
+	var targets map[int]int
+	if prog.Markers, targets, err = prog.resolve(); err != nil {
+		return
+	}
+	for i, target := range targets {
+		prog.Tokens[i].Value = target
+	}
+
+	return
+}
+
+// ParseWithPolicy will parse the tokens like Parse, and return an
+// error if the program uses keywords that the policy disables.
+func ParseWithPolicy(tokens []lexer.Token, policy Policy) (prog Program, err error) {
+	if prog, err = Parse(tokens); err != nil {
+		return
+	}
+	err = policy.Check(&prog)
+	return
+}
+
+// resolve finds the markers of the program and the jump target of
+// every IF, IFTRUE, ELSE and FUNC by the index of its token, without
+// modifying the program.
+func (prog *Program) resolve() (markers map[string]int, targets map[int]int, err error) {
+	tokens := prog.Tokens
+	markers = make(map[string]int)
+	targets = make(map[int]int)
+
+	// Indexes of the IF, IFTRUE, ELSE and FUNC tokens waiting for their
+	// ENDIF and ENDFUNC, the innermost block is last.
+	var open []int
 
 	for i := 0; i < len(tokens); i++ {
-		token := tokens[i]
-		switch token.TokenType {
-		case lexer.TypeMARK:
-			labelToken := tokens[i+1]
-			prog.Markers[labelToken.Value.(string)] = i + 1
+		var start int
+		switch tokens[i].TokenType {
+		case lexer.TypeMARK, lexer.TypeFUNC:
+			var label string
+			if label, err = prog.label(i); err != nil {
+				return
+			}
+			markers[label] = i + 1
+			if tokens[i].TokenType == lexer.TypeFUNC {
+				open = append(open, i)
+			}
+			break
+		case lexer.TypeIF, lexer.TypeIFTRUE:
+			open = append(open, i)
+			break
+		case lexer.TypeELSE:
+			// A failed IF jumps to its ELSE, which is then closed
+			// by the ENDIF
+			if len(open) > 0 && tokens[open[len(open)-1]].TokenType == lexer.TypeELSE {
+				err = prog.errorAt(i, "IF already has an ELSE at %s", prog.where(open[len(open)-1]))
+				return
+			}
+			if start, err = prog.closeBlock(open, i, lexer.TypeIF, lexer.TypeIFTRUE); err != nil {
+				return
+			}
+			targets[start] = i
+			open[len(open)-1] = i
 			break
-		case lexer.TypeFUNC:
-			labelToken := tokens[i+1]
-			prog.Markers[labelToken.Value.(string)] = i + 1
-			endPoint := prog.findNext(i, lexer.TypeENDFUNC)
-			prog.Tokens[i].Value = endPoint
+		case lexer.TypeENDIF:
+			if start, err = prog.closeBlock(open, i, lexer.TypeIF, lexer.TypeIFTRUE, lexer.TypeELSE); err != nil {
+				return
+			}
+			targets[start] = i
+			open = open[:len(open)-1]
+			break
+		case lexer.TypeENDFUNC:
+			if start, err = prog.closeBlock(open, i, lexer.TypeFUNC); err != nil {
+				return
+			}
+			targets[start] = i
+			open = open[:len(open)-1]
 			break
-		case lexer.TypeIF:
-			endPoint := prog.findNext(i, lexer.TypeENDIF)
-			prog.Tokens[i].Value = endPoint
 		default:
 			// nothing
 			break
 		}
 	}
 
+	if len(open) > 0 {
+		start := open[len(open)-1]
+		err = prog.errorAt(start, "%s is never closed", lexer.TokenTypeToString(tokens[start].TokenType))
+	}
 	return
 }
 
-func (prog *Program) findNext(index int, tokenType int) int {
-	for cursor := index; cursor < len(prog.Tokens); cursor++ {
-		if prog.Tokens[cursor].TokenType == tokenType {
-			return cursor
+// closeBlock returns the index of the innermost open block, which
+// must be one of the openers for the token at index to close it.
+func (prog *Program) closeBlock(open []int, index int, openers ...int) (int, error) {
+	keyword := lexer.TokenTypeToString(prog.Tokens[index].TokenType)
+	if len(open) == 0 {
+		return 0, prog.errorAt(index, "%s without %s", keyword, lexer.TokenTypeToString(openers[0]))
+	}
+	start := open[len(open)-1]
+	for _, opener := range openers {
+		if prog.Tokens[start].TokenType == opener {
+			return start, nil
 		}
 	}
-	return -1
+	return 0, prog.errorAt(index, "%s crosses %s opened at %s",
+		keyword, lexer.TokenTypeToString(prog.Tokens[start].TokenType), prog.where(start))
+}
+
+// label returns the name following the MARK or FUNC at index.
+func (prog *Program) label(index int) (string, error) {
+	keyword := lexer.TokenTypeToString(prog.Tokens[index].TokenType)
+	if index+1 >= len(prog.Tokens) {
+		return "", prog.errorAt(index, "%s without a label", keyword)
+	}
+	label, ok := prog.Tokens[index+1].Value.(string)
+	if !ok || prog.Tokens[index+1].TokenType != lexer.TypeSTRING {
+		return "", prog.errorAt(index, "%s label must be a STRING", keyword)
+	}
+	return label, nil
 }
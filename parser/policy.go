@@ -0,0 +1,81 @@
+// Copyright 2018 <kassCrypto@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this
+// software and associated documentation files (the "Software"), to deal in the Software
+// without restriction, including without limitation the rights to use, copy, modify,
+// merge, publish, distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to the following
+// conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies
+// or substantial portions of the Software.
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+// INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A
+// PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT
+// HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF
+// CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+// OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package parser
+
+import "splashcode/lexer"
+
+// Policy restricts the keywords a program is allowed to use.
+type Policy struct {
+	NoFunctions bool // Reject FUNC, ENDFUNC, CALL and RETURN
+	NoLoops     bool // Reject MARK and any GOTO that jumps backwards
+	PushOnly    bool // Reject everything but INT, FLOAT, STRING, BOOLEAN and BYTES literals
+}
+
+// Transactional disables loops and functions, as the README
+// recommends for transactional use. Every program accepted by
+// this policy is guaranteed to terminate.
+var Transactional = Policy{NoFunctions: true, NoLoops: true}
+
+// Unlocking is the policy of unlocking scripts, which may only push
+// literals for the locking script to check.
+var Unlocking = Policy{PushOnly: true}
+
+// Allows reports whether the policy permits executing tokenType.
+func (policy Policy) Allows(tokenType int) bool {
+	switch tokenType {
+	case lexer.TypeINT, lexer.TypeFLOAT, lexer.TypeSTRING, lexer.TypeBOOLEAN, lexer.TypeBYTES:
+		return true
+	case lexer.TypeFUNC, lexer.TypeENDFUNC, lexer.TypeCALL, lexer.TypeRETURN:
+		return !policy.NoFunctions && !policy.PushOnly
+	case lexer.TypeMARK:
+		return !policy.NoLoops && !policy.PushOnly
+	}
+	return !policy.PushOnly
+}
+
+// AllowsJump reports whether the policy permits a GOTO at index from
+// to jump to the marker at index to.
+func (policy Policy) AllowsJump(from int, to int) bool {
+	return !policy.NoLoops || to > from
+}
+
+// Check will return an *Error for the first token in the program
+// that the policy does not allow.
+func (policy Policy) Check(prog *Program) error {
+	for i, token := range prog.Tokens {
+		if !policy.Allows(token.TokenType) {
+			return prog.errorAt(i, "%s is disabled by policy", lexer.TokenTypeToString(token.TokenType))
+		}
+		if token.TokenType != lexer.TypeGOTO || !policy.NoLoops {
+			continue
+		}
+		if i+1 >= len(prog.Tokens) {
+			return prog.errorAt(i, "GOTO without a label")
+		}
+		label, _ := prog.Tokens[i+1].Value.(string)
+		target, ok := prog.Markers[label]
+		if !ok {
+			return prog.errorAt(i, "GOTO to unknown label %q", label)
+		}
+		if !policy.AllowsJump(i, target) {
+			return prog.errorAt(i, "backward GOTO to %q is disabled by policy", label)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+// Copyright 2018 <kassCrypto@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this
+// software and associated documentation files (the "Software"), to deal in the Software
+// without restriction, including without limitation the rights to use, copy, modify,
+// merge, publish, distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to the following
+// conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies
+// or substantial portions of the Software.
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+// INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A
+// PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT
+// HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF
+// CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+// OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package parser
+
+import (
+	"fmt"
+	"splashcode/lexer"
+)
+
+// Verify will check a program that did not come from Parse, such as
+// one decoded from bytecode, is safe to execute. It checks that every
+// token type is known, every literal and operand has the right type,
+// that jump targets match the block structure and markers point at
+// labels, and that the program is allowed by the policy.
+func Verify(prog *Program, policy Policy) error {
+	for i, token := range prog.Tokens {
+		if !lexer.IsTokenType(token.TokenType) {
+			return prog.errorAt(i, "unknown token type %d", token.TokenType)
+		}
+
+		ok := true
+		switch token.TokenType {
+		case lexer.TypeINT:
+			_, ok = token.Value.(int64)
+		case lexer.TypeFLOAT:
+			_, ok = token.Value.(float64)
+		case lexer.TypeSTRING:
+			_, ok = token.Value.(string)
+		case lexer.TypeBOOLEAN:
+			_, ok = token.Value.(bool)
+		case lexer.TypeBYTES:
+			_, ok = token.Value.([]byte)
+		case lexer.TypeIF, lexer.TypeIFTRUE, lexer.TypeELSE, lexer.TypeFUNC:
+			_, ok = token.Value.(int)
+		default:
+			ok = token.Value == nil
+		}
+		if !ok {
+			return prog.errorAt(i, "%s has a %T value", lexer.TokenTypeToString(token.TokenType), token.Value)
+		}
+
+		switch token.TokenType {
+		case lexer.TypeGOTO, lexer.TypeCALL:
+			if _, err := prog.label(i); err != nil {
+				return err
+			}
+		case lexer.TypePICK, lexer.TypeROLL:
+			if i+1 >= len(prog.Tokens) || prog.Tokens[i+1].TokenType != lexer.TypeINT {
+				return prog.errorAt(i, "%s must be followed by an INT", lexer.TokenTypeToString(token.TokenType))
+			}
+		}
+	}
+
+	// The stored jump targets and markers must be the ones the
+	// parser would have found
+	markers, targets, err := prog.resolve()
+	if err != nil {
+		return err
+	}
+	for i, target := range targets {
+		if prog.Tokens[i].Value.(int) != target {
+			return prog.errorAt(i, "%s jumps to token %v, expected %d",
+				lexer.TokenTypeToString(prog.Tokens[i].TokenType), prog.Tokens[i].Value, target)
+		}
+	}
+	for label, index := range prog.Markers {
+		if expected, ok := markers[label]; !ok || index != expected {
+			return &Error{Index: index, Msg: fmt.Sprintf("marker %q does not point at its MARK or FUNC label", label)}
+		}
+	}
+	for label, index := range markers {
+		if _, ok := prog.Markers[label]; !ok {
+			return &Error{Index: index, Msg: fmt.Sprintf("missing marker %q", label)}
+		}
+	}
+
+	return policy.Check(prog)
+}
@@ -0,0 +1,341 @@
+// Copyright 2018 <kassCrypto@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this
+// software and associated documentation files (the "Software"), to deal in the Software
+// without restriction, including without limitation the rights to use, copy, modify,
+// merge, publish, distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to the following
+// conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies
+// or substantial portions of the Software.
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+// INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A
+// PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT
+// HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF
+// CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+// OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// Package templates builds the standard locking scripts from their
+// parameters, and recognises them so wallets can classify outputs.
+//
+//	PayToPubKeyHash  DUP, HASH160, 0x<pubkey hash>, EQUALVERIFY, CHECKSIG
+//	PayToScriptHash  HASH160, 0x<script hash>, EQ
+//	HashLock         HASH, 0x<hash>, EQ
+//	HTLC             IFTRUE,
+//	                     HASH, 0x<hash>, EQUALVERIFY,
+//	                     DUP, HASH160, 0x<pubkey hash>,
+//	                 ELSE,
+//	                     <lock time>, CHECKLOCKTIME, DROP,
+//	                     DUP, HASH160, 0x<refund pubkey hash>,
+//	                 ENDIF, EQUALVERIFY, CHECKSIG
+//	Multisig         <M>, 0x<pubkey 1>, ..., 0x<pubkey N>, <N>, CHECKMULTISIG
+//	TimelockRefund   <lock time>, CHECKLOCKTIME, DROP,
+//	                 DUP, HASH160, 0x<pubkey hash>, EQUALVERIFY, CHECKSIG
+//
+// Public key hashes and script hashes are the HASH160 of the key or
+// of the bytecode of the redeem script, a hash is the HASH (sha256)
+// of the secret.
+package templates
+
+import (
+	"fmt"
+	"splashcode/executor"
+	"splashcode/lexer"
+	"splashcode/parser"
+)
+
+// Kind identifies a standard script.
+type Kind int
+
+const (
+	NonStandard     = Kind(iota) // Not one of the templates
+	PayToPubKeyHash = Kind(iota) // Spent with a signature and the public key
+	PayToScriptHash = Kind(iota) // Spent with the redeem script, see executor.RunPair
+	HashLock        = Kind(iota) // Spent by anyone who knows the secret
+	HTLC            = Kind(iota) // Spent with the secret, or refunded after the lock time
+	Multisig        = Kind(iota) // Spent with M signatures of N public keys
+	TimelockRefund  = Kind(iota) // Spent with a signature after the lock time
+)
+
+func (kind Kind) String() string {
+	switch kind {
+	case NonStandard:
+		return "nonstandard"
+	case PayToPubKeyHash:
+		return "pubkeyhash"
+	case PayToScriptHash:
+		return "scripthash"
+	case HashLock:
+		return "hashlock"
+	case HTLC:
+		return "htlc"
+	case Multisig:
+		return "multisig"
+	case TimelockRefund:
+		return "timelockrefund"
+	default:
+		return "unknown"
+	}
+}
+
+// Params are the parameters of a template, only the fields used by
+// its Kind are set.
+type Params struct {
+	PubKeyHash       []byte   // PayToPubKeyHash, TimelockRefund and the claim of an HTLC
+	RefundPubKeyHash []byte   // The refund of an HTLC
+	ScriptHash       []byte   // PayToScriptHash
+	Hash             []byte   // HashLock and HTLC
+	LockTime         int64    // HTLC and TimelockRefund, a height or unix time like CHECKLOCKTIME
+	Required         int      // Multisig, the number of signatures needed
+	PubKeys          [][]byte // Multisig
+}
+
+// HashSize is the length of a HASH.
+const HashSize = 32
+
+// slot is a parameter in a pattern.
+type slot int
+
+const (
+	pubKeyHash       = slot(iota)
+	refundPubKeyHash = slot(iota)
+	scriptHash       = slot(iota)
+	hash             = slot(iota)
+	lockTime         = slot(iota)
+)
+
+// patterns lists the tokens of every template but Multisig, an int
+// is a keyword and a slot is a parameter.
+var patterns = []struct {
+	kind   Kind
+	tokens []interface{}
+}{
+	{PayToPubKeyHash, []interface{}{
+		lexer.TypeDUP, lexer.TypeHASH160, pubKeyHash, lexer.TypeEQUALVERIFY, lexer.TypeCHECKSIG,
+	}},
+	{PayToScriptHash, []interface{}{
+		lexer.TypeHASH160, scriptHash, lexer.TypeEQ,
+	}},
+	{HashLock, []interface{}{
+		lexer.TypeHASH, hash, lexer.TypeEQ,
+	}},
+	{HTLC, []interface{}{
+		lexer.TypeIFTRUE,
+		lexer.TypeHASH, hash, lexer.TypeEQUALVERIFY,
+		lexer.TypeDUP, lexer.TypeHASH160, pubKeyHash,
+		lexer.TypeELSE,
+		lockTime, lexer.TypeCHECKLOCKTIME, lexer.TypeDROP,
+		lexer.TypeDUP, lexer.TypeHASH160, refundPubKeyHash,
+		lexer.TypeENDIF, lexer.TypeEQUALVERIFY, lexer.TypeCHECKSIG,
+	}},
+	{TimelockRefund, []interface{}{
+		lockTime, lexer.TypeCHECKLOCKTIME, lexer.TypeDROP,
+		lexer.TypeDUP, lexer.TypeHASH160, pubKeyHash, lexer.TypeEQUALVERIFY, lexer.TypeCHECKSIG,
+	}},
+}
+
+// Build will generate the locking script of kind from params. An
+// error is returned if a parameter is missing or has the wrong size.
+func Build(kind Kind, params Params) (parser.Program, error) {
+	var tokens []lexer.Token
+	if kind == Multisig {
+		if err := checkMultisig(params.Required, params.PubKeys); err != nil {
+			return parser.Program{}, err
+		}
+		tokens = append(tokens, intToken(int64(params.Required)))
+		for _, pub := range params.PubKeys {
+			tokens = append(tokens, bytesToken(pub))
+		}
+		tokens = append(tokens, intToken(int64(len(params.PubKeys))), lexer.Token{TokenType: lexer.TypeCHECKMULTISIG})
+		return parser.Parse(tokens)
+	}
+
+	pattern := findPattern(kind)
+	if pattern == nil {
+		return parser.Program{}, fmt.Errorf("templates: unknown kind %v", kind)
+	}
+	for _, item := range pattern {
+		switch item := item.(type) {
+		case int:
+			tokens = append(tokens, lexer.Token{TokenType: item})
+			break
+		case slot:
+			token, err := item.token(&params)
+			if err != nil {
+				return parser.Program{}, err
+			}
+			tokens = append(tokens, token)
+			break
+		}
+	}
+	return parser.Parse(tokens)
+}
+
+// Match recognises prog as one of the templates and returns its kind
+// and parameters. NonStandard is returned for any other program.
+func Match(prog *parser.Program) (Kind, Params) {
+	if params, ok := matchMultisig(prog.Tokens); ok {
+		return Multisig, params
+	}
+NextPattern:
+	for _, p := range patterns {
+		if len(p.tokens) != len(prog.Tokens) {
+			continue
+		}
+		var params Params
+		for i, item := range p.tokens {
+			token := prog.Tokens[i]
+			switch item := item.(type) {
+			case int:
+				if token.TokenType != item {
+					continue NextPattern
+				}
+				break
+			case slot:
+				if !item.set(&params, token) {
+					continue NextPattern
+				}
+				break
+			}
+		}
+		return p.kind, params
+	}
+	return NonStandard, Params{}
+}
+
+// findPattern returns the pattern of kind, or nil.
+func findPattern(kind Kind) []interface{} {
+	for _, p := range patterns {
+		if p.kind == kind {
+			return p.tokens
+		}
+	}
+	return nil
+}
+
+// token returns the literal of the slot in params.
+func (s slot) token(params *Params) (lexer.Token, error) {
+	if s == lockTime {
+		if params.LockTime < 0 {
+			return lexer.Token{}, fmt.Errorf("templates: negative lock time %d", params.LockTime)
+		}
+		return intToken(params.LockTime), nil
+	}
+	b := *s.field(params)
+	if len(b) != s.size() {
+		return lexer.Token{}, fmt.Errorf("templates: %s must be %d bytes, got %d", s, s.size(), len(b))
+	}
+	return bytesToken(b), nil
+}
+
+// set stores the literal token in params, it reports whether the
+// token fits the slot.
+func (s slot) set(params *Params, token lexer.Token) bool {
+	if s == lockTime {
+		v, ok := token.Value.(int64)
+		if !ok || token.TokenType != lexer.TypeINT || v < 0 {
+			return false
+		}
+		params.LockTime = v
+		return true
+	}
+	b, ok := token.Value.([]byte)
+	if !ok || token.TokenType != lexer.TypeBYTES || len(b) != s.size() {
+		return false
+	}
+	*s.field(params) = append([]byte(nil), b...)
+	return true
+}
+
+// field returns the field of params holding a bytes slot.
+func (s slot) field(params *Params) *[]byte {
+	switch s {
+	case pubKeyHash:
+		return &params.PubKeyHash
+	case refundPubKeyHash:
+		return &params.RefundPubKeyHash
+	case scriptHash:
+		return &params.ScriptHash
+	default:
+		return &params.Hash
+	}
+}
+
+// size returns the length of a bytes slot.
+func (s slot) size() int {
+	if s == hash {
+		return HashSize
+	}
+	return executor.ScriptHashSize
+}
+
+func (s slot) String() string {
+	switch s {
+	case pubKeyHash:
+		return "PubKeyHash"
+	case refundPubKeyHash:
+		return "RefundPubKeyHash"
+	case scriptHash:
+		return "ScriptHash"
+	case hash:
+		return "Hash"
+	default:
+		return "LockTime"
+	}
+}
+
+// checkMultisig checks the parameters of a Multisig.
+func checkMultisig(required int, pubs [][]byte) error {
+	if len(pubs) == 0 || len(pubs) > executor.MaxMultisigKeys {
+		return fmt.Errorf("templates: multisig needs 1 to %d public keys, got %d", executor.MaxMultisigKeys, len(pubs))
+	}
+	if required < 1 || required > len(pubs) {
+		return fmt.Errorf("templates: multisig needs 1 to %d signatures, got %d", len(pubs), required)
+	}
+	for i, pub := range pubs {
+		if !isPubKey(pub) {
+			return fmt.Errorf("templates: public key %d has invalid length %d", i, len(pub))
+		}
+	}
+	return nil
+}
+
+// matchMultisig extracts the parameters of a Multisig.
+func matchMultisig(tokens []lexer.Token) (params Params, ok bool) {
+	n := len(tokens) - 3
+	if n < 1 || tokens[n+2].TokenType != lexer.TypeCHECKMULTISIG {
+		return
+	}
+	required, ok := tokens[0].Value.(int64)
+	count, ok2 := tokens[n+1].Value.(int64)
+	if !ok || !ok2 || tokens[0].TokenType != lexer.TypeINT || tokens[n+1].TokenType != lexer.TypeINT || count != int64(n) {
+		return params, false
+	}
+	for _, token := range tokens[1 : n+1] {
+		pub, isBytes := token.Value.([]byte)
+		if !isBytes || token.TokenType != lexer.TypeBYTES {
+			return params, false
+		}
+		params.PubKeys = append(params.PubKeys, append([]byte(nil), pub...))
+	}
+	if required > int64(n) || checkMultisig(int(required), params.PubKeys) != nil {
+		return Params{}, false
+	}
+	params.Required = int(required)
+	return params, true
+}
+
+// isPubKey reports whether b has the length of a key CHECKSIG
+// accepts, Ed25519 or a compressed or uncompressed P-256 point.
+func isPubKey(b []byte) bool {
+	return len(b) == 32 || len(b) == 33 || len(b) == 65
+}
+
+func intToken(v int64) lexer.Token {
+	return lexer.Token{TokenType: lexer.TypeINT, Value: v}
+}
+
+func bytesToken(b []byte) lexer.Token {
+	return lexer.Token{TokenType: lexer.TypeBYTES, Value: append([]byte(nil), b...)}
+}
@@ -0,0 +1,239 @@
+// Copyright 2018 <kassCrypto@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this
+// software and associated documentation files (the "Software"), to deal in the Software
+// without restriction, including without limitation the rights to use, copy, modify,
+// merge, publish, distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to the following
+// conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies
+// or substantial portions of the Software.
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+// INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A
+// PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT
+// HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF
+// CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+// OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package templates
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"reflect"
+	"splashcode/bytecode"
+	"splashcode/executor"
+	"splashcode/lexer"
+	"splashcode/parser"
+	"testing"
+)
+
+var (
+	digest  = sha256.Sum256([]byte("transaction"))
+	secret  = []byte("secret")
+	hashed  = sha256.Sum256(secret)
+	edPriv  = ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	ecPriv  = mustECDSA()
+	ecPriv2 = mustECDSA()
+)
+
+func mustECDSA() *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
+
+func edPub() []byte { return edPriv.Public().(ed25519.PublicKey) }
+
+func edSig() []byte { return ed25519.Sign(edPriv, digest[:]) }
+
+func ecPub(key *ecdsa.PrivateKey) []byte {
+	pub, err := key.PublicKey.Bytes()
+	if err != nil {
+		panic(err)
+	}
+	return pub
+}
+
+func ecSig(key *ecdsa.PrivateKey) []byte {
+	sig, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	if err != nil {
+		panic(err)
+	}
+	return sig
+}
+
+// hash160 runs HASH160 on b.
+func hash160(t *testing.T, b []byte) []byte {
+	prog, err := parser.Parse([]lexer.Token{bytesToken(b), {TokenType: lexer.TypeHASH160}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := executor.Execute(&prog, lexer.Token{}, executor.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result.Last.Value.([]byte)
+}
+
+func boolToken(b bool) lexer.Token {
+	return lexer.Token{TokenType: lexer.TypeBOOLEAN, Value: b}
+}
+
+// testParams returns valid parameters for every kind.
+func testParams(t *testing.T) map[Kind]Params {
+	return map[Kind]Params{
+		PayToPubKeyHash: {PubKeyHash: hash160(t, edPub())},
+		PayToScriptHash: {ScriptHash: hash160(t, []byte("redeem"))},
+		HashLock:        {Hash: hashed[:]},
+		HTLC:            {Hash: hashed[:], PubKeyHash: hash160(t, edPub()), RefundPubKeyHash: hash160(t, ecPub(ecPriv)), LockTime: 100},
+		Multisig:        {Required: 2, PubKeys: [][]byte{edPub(), ecPub(ecPriv), ecPub(ecPriv2)}},
+		TimelockRefund:  {PubKeyHash: hash160(t, ecPub(ecPriv)), LockTime: 100},
+	}
+}
+
+func TestBuildMatch(t *testing.T) {
+	for kind, params := range testParams(t) {
+		prog, err := Build(kind, params)
+		if err != nil {
+			t.Errorf("%v: %v", kind, err)
+			continue
+		}
+		gotKind, got := Match(&prog)
+		if gotKind != kind || !reflect.DeepEqual(got, params) {
+			t.Errorf("%v: matched %v %+v, want %+v", kind, gotKind, got, params)
+		}
+	}
+}
+
+func TestMatchNearMiss(t *testing.T) {
+	mutations := []struct {
+		name   string
+		mutate func(tokens []lexer.Token) []lexer.Token
+	}{
+		{"short bytes", func(tokens []lexer.Token) []lexer.Token {
+			for i, token := range tokens {
+				if b, ok := token.Value.([]byte); ok {
+					tokens[i] = bytesToken(b[1:])
+					break
+				}
+			}
+			return tokens
+		}},
+		{"swapped opcode", func(tokens []lexer.Token) []lexer.Token {
+			for i, token := range tokens {
+				if token.Value == nil {
+					tokens[i].TokenType = lexer.TypeDROP
+					if token.TokenType == lexer.TypeDROP {
+						tokens[i].TokenType = lexer.TypeDUP
+					}
+					break
+				}
+			}
+			return tokens
+		}},
+		{"extra token", func(tokens []lexer.Token) []lexer.Token {
+			return append(tokens, lexer.Token{TokenType: lexer.TypeDROP})
+		}},
+	}
+
+	for kind, params := range testParams(t) {
+		prog, err := Build(kind, params)
+		if err != nil {
+			t.Fatalf("%v: %v", kind, err)
+		}
+		for _, m := range mutations {
+			tokens := m.mutate(append([]lexer.Token(nil), prog.Tokens...))
+			if got, _ := Match(&parser.Program{Tokens: tokens}); got != NonStandard {
+				t.Errorf("%v with %s: matched %v", kind, m.name, got)
+			}
+		}
+	}
+}
+
+func TestRunPair(t *testing.T) {
+	redeem, err := Build(Multisig, Params{Required: 1, PubKeys: [][]byte{edPub(), ecPub(ecPriv)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	redeemData, err := bytecode.Encode(&redeem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scriptHash, err := executor.ScriptHash(&redeem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := testParams(t)
+
+	tests := []struct {
+		name   string
+		kind   Kind
+		params Params
+		unlock []lexer.Token
+		height int64
+		pass   bool
+	}{
+		{"p2pkh ed25519", PayToPubKeyHash, params[PayToPubKeyHash],
+			[]lexer.Token{bytesToken(edSig()), bytesToken(edPub())}, 0, true},
+		{"p2pkh ecdsa", PayToPubKeyHash, Params{PubKeyHash: hash160(t, ecPub(ecPriv))},
+			[]lexer.Token{bytesToken(ecSig(ecPriv)), bytesToken(ecPub(ecPriv))}, 0, true},
+		{"p2pkh wrong key", PayToPubKeyHash, params[PayToPubKeyHash],
+			[]lexer.Token{bytesToken(ecSig(ecPriv)), bytesToken(ecPub(ecPriv))}, 0, false},
+		{"p2sh", PayToScriptHash, Params{ScriptHash: scriptHash},
+			[]lexer.Token{bytesToken(ecSig(ecPriv)), bytesToken(redeemData)}, 0, true},
+		{"p2sh bad signature", PayToScriptHash, Params{ScriptHash: scriptHash},
+			[]lexer.Token{bytesToken(ecSig(ecPriv2)), bytesToken(redeemData)}, 0, false},
+		{"hash lock", HashLock, params[HashLock],
+			[]lexer.Token{bytesToken(secret)}, 0, true},
+		{"hash lock wrong secret", HashLock, params[HashLock],
+			[]lexer.Token{bytesToken([]byte("guess"))}, 0, false},
+		{"htlc claim", HTLC, params[HTLC],
+			[]lexer.Token{bytesToken(edSig()), bytesToken(edPub()), bytesToken(secret), boolToken(true)}, 0, true},
+		{"htlc refund", HTLC, params[HTLC],
+			[]lexer.Token{bytesToken(ecSig(ecPriv)), bytesToken(ecPub(ecPriv)), boolToken(false)}, 100, true},
+		{"htlc early refund", HTLC, params[HTLC],
+			[]lexer.Token{bytesToken(ecSig(ecPriv)), bytesToken(ecPub(ecPriv)), boolToken(false)}, 99, false},
+		{"multisig 2 of 3", Multisig, params[Multisig],
+			[]lexer.Token{bytesToken(edSig()), bytesToken(ecSig(ecPriv2))}, 0, true},
+		{"multisig out of order", Multisig, params[Multisig],
+			[]lexer.Token{bytesToken(ecSig(ecPriv2)), bytesToken(edSig())}, 0, false},
+		{"timelock refund", TimelockRefund, params[TimelockRefund],
+			[]lexer.Token{bytesToken(ecSig(ecPriv)), bytesToken(ecPub(ecPriv))}, 100, true},
+		{"timelock refund early", TimelockRefund, params[TimelockRefund],
+			[]lexer.Token{bytesToken(ecSig(ecPriv)), bytesToken(ecPub(ecPriv))}, 99, false},
+	}
+
+	for _, test := range tests {
+		lockProg, err := Build(test.kind, test.params)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		lock, err := executor.Compile(&lockProg)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		unlockProg, err := parser.Parse(test.unlock)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		unlock, err := executor.Compile(&unlockProg)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		config := executor.Config{
+			Context:         &executor.MockContext{TxDigest: digest[:], TxBlockHeight: test.height},
+			PayToScriptHash: true,
+		}
+		if _, err := executor.RunPair(unlock, lock, config); (err == nil) != test.pass {
+			t.Errorf("%s: got %v, want pass %v", test.name, err, test.pass)
+		}
+	}
+}